@@ -0,0 +1,41 @@
+// Package dbtest provides databases for tests.
+package dbtest // import "github.com/LiangNing7/goutils/pkg/db/dbtest"
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+)
+
+// NewSQLite creates a SQLite database with db.NewSQLite, in a file of a
+// temporary directory of t unless opts sets a path, and closes it when t
+// completes. opts may be nil, and logs are discarded unless opts sets a
+// logger. The tables of the given models are created.
+func NewSQLite(t testing.TB, opts *db.SQLiteOptions, models ...any) *gorm.DB {
+	t.Helper()
+
+	o := db.SQLiteOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Path == "" && !o.InMemory {
+		o.Path = filepath.Join(t.TempDir(), "sqlite.db")
+	}
+	if o.Logger == nil {
+		o.Logger = logger.Discard
+	}
+
+	gdb, err := db.NewSQLite(&o)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.MustRawDB(gdb).Close() })
+
+	if len(models) > 0 {
+		require.NoError(t, gdb.AutoMigrate(models...))
+	}
+	return gdb
+}
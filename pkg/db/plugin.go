@@ -1,62 +1,213 @@
 package db
 
 import (
+	"errors"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
-	"k8s.io/klog/v2"
+
+	"github.com/LiangNing7/goutils/pkg/log"
 )
 
 const (
 	callBackBeforeName = "core:before"
 	callBackAfterName  = "core:after"
 	startTime          = "_start_time"
+	traceSpan          = "_trace_span"
+
+	// instrumentationName is the name of the tracer used by TracePlugin.
+	instrumentationName = "github.com/LiangNing7/goutils/pkg/db"
+	// maxStatementLength is the length beyond which statements are truncated
+	// in spans and logs.
+	maxStatementLength = 2048
 )
 
-// TracePlugin defines gorm plugin used to trace sql.
-type TracePlugin struct{}
+// TracePlugin defines gorm plugin used to trace sql. Each statement runs
+// within an OpenTelemetry span, created with the global tracer provider
+// unless TracerProvider is set, and its duration is recorded by table and
+// operation in the gorm_statement_duration_seconds Prometheus histogram.
+// Statements are not traced in dry run mode.
+type TracePlugin struct {
+	// SlowThreshold is the duration beyond which statements are logged as
+	// slow queries. Zero disables the slow query log.
+	// +optional
+	SlowThreshold time.Duration
+	// RedactParams replaces the parameters of the statements with their
+	// placeholders in spans and logs, so that no data is leaked.
+	// +optional
+	RedactParams bool
+	// Registerer registers the metrics, prometheus.DefaultRegisterer by default.
+	// Metrics already registered by another TracePlugin are shared with it.
+	// +optional
+	Registerer prometheus.Registerer
+	// TracerProvider creates the spans, the global tracer provider by default.
+	// +optional
+	TracerProvider trace.TracerProvider
+}
 
 // Name returns the name of trace plugin.
 func (op *TracePlugin) Name() string {
 	return "tracePlugin"
 }
 
-// Initialize initialize the trace plugin.
+// Initialize registers the callbacks tracing the statements of db. The plugin
+// itself is left unchanged, so that one TracePlugin may be used by several
+// connections, e.g. by all the databases of a Cluster.
 func (op *TracePlugin) Initialize(db *gorm.DB) (err error) {
+	provider := op.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	st := &statementTracer{
+		slowThreshold: op.SlowThreshold,
+		redactParams:  op.RedactParams,
+		tracer:        provider.Tracer(instrumentationName),
+	}
+
+	registerer := op.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	st.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gorm",
+		Name:      "statement_duration_seconds",
+		Help:      "Duration of SQL statements, by table and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"table", "operation"})
+	if err := register(registerer, &st.duration); err != nil {
+		return err
+	}
+
 	// 开始前
-	_ = db.Callback().Create().Before("gorm:before_create").Register(callBackBeforeName, before)
-	_ = db.Callback().Query().Before("gorm:query").Register(callBackBeforeName, before)
-	_ = db.Callback().Delete().Before("gorm:before_delete").Register(callBackBeforeName, before)
-	_ = db.Callback().Update().Before("gorm:setup_reflect_value").Register(callBackBeforeName, before)
-	_ = db.Callback().Row().Before("gorm:row").Register(callBackBeforeName, before)
-	_ = db.Callback().Raw().Before("gorm:raw").Register(callBackBeforeName, before)
+	_ = db.Callback().Create().Before("gorm:before_create").Register(callBackBeforeName, st.before("create"))
+	_ = db.Callback().Query().Before("gorm:query").Register(callBackBeforeName, st.before("query"))
+	_ = db.Callback().Delete().Before("gorm:before_delete").Register(callBackBeforeName, st.before("delete"))
+	_ = db.Callback().Update().Before("gorm:setup_reflect_value").Register(callBackBeforeName, st.before("update"))
+	_ = db.Callback().Row().Before("gorm:row").Register(callBackBeforeName, st.before("row"))
+	_ = db.Callback().Raw().Before("gorm:raw").Register(callBackBeforeName, st.before("raw"))
 
 	// 结束后
-	_ = db.Callback().Create().After("gorm:after_create").Register(callBackAfterName, after)
-	_ = db.Callback().Query().After("gorm:after_query").Register(callBackAfterName, after)
-	_ = db.Callback().Delete().After("gorm:after_delete").Register(callBackAfterName, after)
-	_ = db.Callback().Update().After("gorm:after_update").Register(callBackAfterName, after)
-	_ = db.Callback().Row().After("gorm:row").Register(callBackAfterName, after)
-	_ = db.Callback().Raw().After("gorm:raw").Register(callBackAfterName, after)
+	_ = db.Callback().Create().After("gorm:after_create").Register(callBackAfterName, st.after)
+	_ = db.Callback().Query().After("gorm:after_query").Register(callBackAfterName, st.after)
+	_ = db.Callback().Delete().After("gorm:after_delete").Register(callBackAfterName, st.after)
+	_ = db.Callback().Update().After("gorm:after_update").Register(callBackAfterName, st.after)
+	_ = db.Callback().Row().After("gorm:row").Register(callBackAfterName, st.after)
+	_ = db.Callback().Raw().After("gorm:raw").Register(callBackAfterName, st.after)
 
 	return
 }
 
 var _ gorm.Plugin = &TracePlugin{}
 
-func before(db *gorm.DB) {
-	db.InstanceSet(startTime, time.Now())
+// statementTracer traces the statements of the connection which a TracePlugin
+// has been initialized with.
+type statementTracer struct {
+	slowThreshold time.Duration
+	redactParams  bool
+	tracer        trace.Tracer
+	duration      *prometheus.HistogramVec
 }
 
-func after(db *gorm.DB) {
+// before returns the callback starting the span of a statement of the given kind.
+func (st *statementTracer) before(kind string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.DryRun {
+			return
+		}
+
+		ctx, span := st.tracer.Start(db.Statement.Context, "gorm."+kind,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", db.Dialector.Name())),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(traceSpan, span)
+		db.InstanceSet(startTime, time.Now())
+	}
+}
+
+// after ends the span of the statement and records its duration.
+func (st *statementTracer) after(db *gorm.DB) {
 	_ts, isExist := db.InstanceGet(startTime)
 	if !isExist {
 		return
 	}
-
 	ts, ok := _ts.(time.Time)
 	if !ok {
 		return
 	}
-	klog.V(4).Infof("sql cost time: %fs", time.Since(ts).Seconds())
+	elapsed := time.Since(ts)
+
+	sql := db.Statement.SQL.String()
+	table := db.Statement.Table
+	operation := operationOf(sql)
+	st.duration.WithLabelValues(table, operation).Observe(elapsed.Seconds())
+
+	statement := sql
+	if !st.redactParams {
+		statement = db.Dialector.Explain(sql, db.Statement.Vars...)
+	}
+	statement = sanitize(statement)
+
+	if _span, ok := db.InstanceGet(traceSpan); ok {
+		if span, ok := _span.(trace.Span); ok {
+			span.SetAttributes(
+				attribute.String("db.statement", statement),
+				attribute.String("db.sql.table", table),
+				attribute.String("db.operation", operation),
+			)
+			// Rows are not counted by the Row and Rows methods
+			if db.Statement.RowsAffected >= 0 {
+				span.SetAttributes(attribute.Int64("db.rows_affected", db.Statement.RowsAffected))
+			}
+			if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+
+	if st.slowThreshold > 0 && elapsed > st.slowThreshold {
+		log.Warnw("Slow SQL query", "elapsed", elapsed, "threshold", st.slowThreshold, "table", table,
+			"operation", operation, "rows", db.Statement.RowsAffected, "sql", statement)
+	}
+}
+
+// operationOf returns the operation of sql, e.g. "select" or "insert".
+func operationOf(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// sanitize collapses the whitespace of statement and truncates it to
+// maxStatementLength bytes.
+func sanitize(statement string) string {
+	statement = strings.Join(strings.Fields(statement), " ")
+	if len(statement) > maxStatementLength {
+		statement = strings.ToValidUTF8(statement[:maxStatementLength], "") + "..."
+	}
+	return statement
+}
+
+// register registers the collector, or replaces it with the equal collector
+// which is already registered.
+func register[T prometheus.Collector](registerer prometheus.Registerer, collector *T) error {
+	err := registerer.Register(*collector)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			*collector = existing
+			return nil
+		}
+	}
+	return err
 }
@@ -0,0 +1,174 @@
+package db_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+	"github.com/LiangNing7/goutils/pkg/log"
+)
+
+type User struct {
+	ID   int64
+	Name string
+}
+
+// newTracedDB 创建使用 plugin 的 SQLite 数据库, 并返回记录 span 的 SpanRecorder.
+func newTracedDB(t *testing.T, plugin *db.TracePlugin) (*gorm.DB, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	plugin.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return dbtest.NewSQLite(t, &db.SQLiteOptions{TracePlugin: plugin}, &User{}), recorder
+}
+
+// attributes 返回名为 name 的最后一个 span 的属性.
+func attributes(t *testing.T, recorder *tracetest.SpanRecorder, name string) map[attribute.Key]attribute.Value {
+	spans := recorder.Ended()
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Name() == name {
+			ret := make(map[attribute.Key]attribute.Value)
+			for _, kv := range spans[i].Attributes() {
+				ret[kv.Key] = kv.Value
+			}
+			return ret
+		}
+	}
+	require.Failf(t, "span not found", "no span named %s", name)
+	return nil
+}
+
+// captureLogs 把全局日志写入临时文件, 返回读取日志的函数.
+func captureLogs(t *testing.T) func() string {
+	path := filepath.Join(t.TempDir(), "log")
+	log.Init(&log.Options{Level: "info", Format: "json", OutputPaths: []string{path}})
+	t.Cleanup(func() { log.Init(log.NewOptions()) })
+	return func() string {
+		log.Sync()
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(data)
+	}
+}
+
+// sampleCounts 返回直方图中按 "表/操作" 统计的语句数.
+func sampleCounts(t *testing.T, registry *prometheus.Registry) map[string]uint64 {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["table"]+"/"+labels["operation"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
+}
+
+func TestTracePlugin(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gdb, recorder := newTracedDB(t, &db.TracePlugin{Registerer: registry})
+
+	require.NoError(t, gdb.Create(&User{Name: "alice"}).Error)
+	var user User
+	require.NoError(t, gdb.Where("name = ?", "alice").First(&user).Error)
+	require.ErrorIs(t, gdb.Where("name = ?", "bob").First(&user).Error, gorm.ErrRecordNotFound)
+
+	// span 记录语句、表、操作和影响的行数
+	create := attributes(t, recorder, "gorm.create")
+	assert.Equal(t, "sqlite", create["db.system"].AsString())
+	assert.Equal(t, "INSERT INTO `users` (`name`) VALUES (\"alice\") RETURNING `id`", create["db.statement"].AsString())
+	assert.Equal(t, "users", create["db.sql.table"].AsString())
+	assert.Equal(t, "insert", create["db.operation"].AsString())
+	assert.EqualValues(t, 1, create["db.rows_affected"].AsInt64())
+
+	query := attributes(t, recorder, "gorm.query")
+	assert.Equal(t, "select", query["db.operation"].AsString())
+	assert.Contains(t, query["db.statement"].AsString(), "WHERE name = \"bob\"")
+	assert.EqualValues(t, 0, query["db.rows_affected"].AsInt64())
+
+	// 耗时按表和操作记录到直方图
+	n, err := testutil.GatherAndCount(registry, "gorm_statement_duration_seconds")
+	require.NoError(t, err)
+	assert.Positive(t, n)
+	counts := sampleCounts(t, registry)
+	assert.EqualValues(t, 1, counts["users/insert"])
+	assert.EqualValues(t, 2, counts["users/select"])
+}
+
+func TestTracePlugin_RedactParams(t *testing.T) {
+	logs := captureLogs(t)
+	gdb, recorder := newTracedDB(t, &db.TracePlugin{RedactParams: true, SlowThreshold: time.Nanosecond, Registerer: prometheus.NewRegistry()})
+
+	// 参数不会出现在 span 和慢查询日志中
+	require.NoError(t, gdb.Create(&User{Name: "s3cr3t"}).Error)
+	statement := attributes(t, recorder, "gorm.create")["db.statement"].AsString()
+	assert.Equal(t, "INSERT INTO `users` (`name`) VALUES (?) RETURNING `id`", statement)
+	for _, span := range recorder.Ended() {
+		for _, kv := range span.Attributes() {
+			assert.NotContains(t, kv.Value.Emit(), "s3cr3t")
+		}
+	}
+	assert.Contains(t, logs(), "Slow SQL query")
+	assert.NotContains(t, logs(), "s3cr3t")
+}
+
+func TestTracePlugin_SlowThreshold(t *testing.T) {
+	logs := captureLogs(t)
+
+	// 未超过阈值的语句不记录慢查询日志
+	fast, _ := newTracedDB(t, &db.TracePlugin{SlowThreshold: time.Hour, Registerer: prometheus.NewRegistry()})
+	require.NoError(t, fast.Create(&User{Name: "alice"}).Error)
+	assert.NotContains(t, logs(), "Slow SQL query")
+
+	slow, _ := newTracedDB(t, &db.TracePlugin{SlowThreshold: time.Nanosecond, Registerer: prometheus.NewRegistry()})
+	require.NoError(t, slow.Create(&User{Name: "bob"}).Error)
+	assert.Contains(t, logs(), "Slow SQL query")
+	assert.Contains(t, logs(), `"sql":"INSERT INTO `+"`users`"+` (`+"`name`"+`) VALUES (\"bob\") RETURNING `+"`id`"+`"`)
+}
+
+func TestTracePlugin_Shared(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	plugin := &db.TracePlugin{Registerer: registry}
+	first, recorder := newTracedDB(t, plugin)
+
+	// 同一个插件可以被多个连接使用, 初始化新连接时不影响已有连接上执行的语句
+	var wg sync.WaitGroup
+	var second *gorm.DB
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		second = dbtest.NewSQLite(t, &db.SQLiteOptions{TracePlugin: plugin}, &User{})
+	}()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, first.Create(&User{Name: "alice"}).Error)
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, second.Create(&User{Name: "bob"}).Error)
+	}
+
+	creates := 0
+	for _, span := range recorder.Ended() {
+		if span.Name() == "gorm.create" {
+			creates++
+		}
+	}
+	assert.Equal(t, 20, creates)
+
+	assert.EqualValues(t, 20, sampleCounts(t, registry)["users/insert"])
+}
@@ -19,8 +19,17 @@ type PostgreSQLOptions struct {
 	MaxIdleConnections    int
 	MaxOpenConnections    int
 	MaxConnectionLifeTime time.Duration
+	// Replicas are the addresses of the read replicas, see NewPostgreSQLCluster.
+	// +optional
+	Replicas []string
+	// ReplicaPolicy selects the replica serving each read, RandomPolicy by default.
+	// +optional
+	ReplicaPolicy ReplicaPolicy
 	// +optional
 	Logger logger.Interface
+	// TracePlugin traces the statements and records their duration, if set.
+	// +optional
+	TracePlugin *TracePlugin
 }
 
 // DSN return DSN from PostgreSQLOptions.
@@ -55,6 +64,12 @@ func NewPostgreSQL(opts *PostgreSQLOptions) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	if opts.TracePlugin != nil {
+		if err := db.Use(opts.TracePlugin); err != nil {
+			return nil, err
+		}
+	}
+
 	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, err
@@ -72,6 +87,18 @@ func NewPostgreSQL(opts *PostgreSQLOptions) (*gorm.DB, error) {
 	return db, nil
 }
 
+// NewPostgreSQLCluster creates a Cluster whose primary is at opts.Addr and whose
+// replicas are at opts.Replicas. The replicas use the same credentials and
+// settings as the primary, including opts.TracePlugin, which is shared by all
+// the databases.
+func NewPostgreSQLCluster(opts *PostgreSQLOptions) (*Cluster, error) {
+	return newCluster(opts.Addr, opts.Replicas, opts.ReplicaPolicy, func(addr string) (*gorm.DB, error) {
+		o := *opts
+		o.Addr = addr
+		return NewPostgreSQL(&o)
+	})
+}
+
 // setPostgreSQLDefaults set available default values for some fields.
 func setPostgreSQLDefaults(opts *PostgreSQLOptions) {
 	if opts.Addr == "" {
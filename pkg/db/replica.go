@@ -0,0 +1,236 @@
+package db
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	callBackReplicaBeforeName = "replica:before"
+	callBackReplicaAfterName  = "replica:after"
+	replicaStartTime          = "_replica_start_time"
+
+	// latencyWeight is the weight of the last query in the average latency of a replica.
+	latencyWeight = 0.2
+
+	// DefaultLatencyExploration is the share of reads which LeastLatencyPolicy
+	// sends to a random replica by default.
+	DefaultLatencyExploration = 0.05
+)
+
+// Names of the replica policies accepted by NewReplicaPolicy.
+const (
+	ReplicaPolicyRandom       = "random"
+	ReplicaPolicyRoundRobin   = "round-robin"
+	ReplicaPolicyLeastLatency = "least-latency"
+)
+
+// ReplicaPolicy selects the replica serving a read.
+type ReplicaPolicy interface {
+	// Pick returns one of replicas, which is never empty.
+	Pick(replicas []*Replica) *Replica
+}
+
+// NewReplicaPolicy returns the replica policy with the given name. An empty
+// name selects the random policy.
+func NewReplicaPolicy(name string) (ReplicaPolicy, error) {
+	switch name {
+	case "", ReplicaPolicyRandom:
+		return RandomPolicy{}, nil
+	case ReplicaPolicyRoundRobin:
+		return &RoundRobinPolicy{}, nil
+	case ReplicaPolicyLeastLatency:
+		return LeastLatencyPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown replica policy %q", name)
+	}
+}
+
+// RandomPolicy picks a replica at random.
+type RandomPolicy struct{}
+
+// Pick implements ReplicaPolicy.
+func (RandomPolicy) Pick(replicas []*Replica) *Replica {
+	return replicas[rand.IntN(len(replicas))]
+}
+
+// RoundRobinPolicy picks the replicas in turn.
+type RoundRobinPolicy struct {
+	next atomic.Uint64
+}
+
+// Pick implements ReplicaPolicy.
+func (p *RoundRobinPolicy) Pick(replicas []*Replica) *Replica {
+	return replicas[(p.next.Add(1)-1)%uint64(len(replicas))]
+}
+
+// LeastLatencyPolicy picks the replica whose recent queries were the fastest.
+// Replicas which have not served any query yet are picked first. The latency
+// of a replica is only updated by the queries it serves, so a share of the
+// reads is sent to a random replica: a replica which was slow for a while is
+// measured again, and picked again once it has recovered.
+type LeastLatencyPolicy struct {
+	// Exploration is the share of reads sent to a random replica, between 0
+	// and 1. DefaultLatencyExploration is used if it is 0, and none of the
+	// reads are if it is negative.
+	Exploration float64
+}
+
+// Pick implements ReplicaPolicy.
+func (p LeastLatencyPolicy) Pick(replicas []*Replica) *Replica {
+	exploration := p.Exploration
+	if exploration == 0 {
+		exploration = DefaultLatencyExploration
+	}
+	if rand.Float64() < exploration {
+		return replicas[rand.IntN(len(replicas))]
+	}
+
+	best := replicas[0]
+	for _, replica := range replicas[1:] {
+		if replica.Latency() < best.Latency() {
+			best = replica
+		}
+	}
+	return best
+}
+
+// Replica is a read-only database of a Cluster.
+type Replica struct {
+	db      *gorm.DB
+	latency atomic.Int64
+}
+
+// newReplica wraps db, recording the latency of its queries.
+func newReplica(db *gorm.DB) (*Replica, error) {
+	r := &Replica{db: db}
+
+	before := func(db *gorm.DB) {
+		db.InstanceSet(replicaStartTime, time.Now())
+	}
+	after := func(db *gorm.DB) {
+		if ts, ok := db.InstanceGet(replicaStartTime); ok && !db.DryRun {
+			r.observe(time.Since(ts.(time.Time)))
+		}
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register(callBackReplicaBeforeName, before); err != nil {
+		return nil, err
+	}
+	if err := db.Callback().Query().After("gorm:after_query").Register(callBackReplicaAfterName, after); err != nil {
+		return nil, err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register(callBackReplicaBeforeName, before); err != nil {
+		return nil, err
+	}
+	if err := db.Callback().Row().After("gorm:row").Register(callBackReplicaAfterName, after); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DB returns the database of the replica.
+func (r *Replica) DB() *gorm.DB {
+	return r.db
+}
+
+// Latency returns the moving average of the duration of the recent queries
+// of the replica, or 0 if it has not served any query yet.
+func (r *Replica) Latency() time.Duration {
+	return time.Duration(r.latency.Load())
+}
+
+// observe adds the duration of a query to the average latency.
+func (r *Replica) observe(d time.Duration) {
+	for {
+		old := r.latency.Load()
+		latency := int64(d)
+		if old != 0 {
+			latency = int64(latencyWeight*float64(d) + (1-latencyWeight)*float64(old))
+		}
+		if r.latency.CompareAndSwap(old, latency) {
+			return
+		}
+	}
+}
+
+// Cluster is a primary database, serving writes, and its read replicas.
+type Cluster struct {
+	primary  *gorm.DB
+	replicas []*Replica
+	policy   ReplicaPolicy
+}
+
+// NewCluster creates a new Cluster. The policy selects the replica of each
+// read and defaults to RandomPolicy. Without replicas, reads are served by
+// the primary.
+func NewCluster(primary *gorm.DB, replicas []*gorm.DB, policy ReplicaPolicy) (*Cluster, error) {
+	if policy == nil {
+		policy = RandomPolicy{}
+	}
+
+	c := &Cluster{primary: primary, policy: policy}
+	for _, db := range replicas {
+		replica, err := newReplica(db)
+		if err != nil {
+			return nil, err
+		}
+		c.replicas = append(c.replicas, replica)
+	}
+	return c, nil
+}
+
+// Primary returns the primary database.
+func (c *Cluster) Primary() *gorm.DB {
+	return c.primary
+}
+
+// Replica returns the database serving the next read, as selected by the
+// replica policy, or the primary if the cluster has no replicas.
+func (c *Cluster) Replica() *gorm.DB {
+	if len(c.replicas) == 0 {
+		return c.primary
+	}
+	return c.policy.Pick(c.replicas).DB()
+}
+
+// Replicas returns the replicas of the cluster.
+func (c *Cluster) Replicas() []*Replica {
+	return c.replicas
+}
+
+// newCluster opens the primary and the replicas at the given addresses with
+// open, and creates a Cluster of them.
+func newCluster(primaryAddr string, replicaAddrs []string, policy ReplicaPolicy, open func(addr string) (*gorm.DB, error)) (*Cluster, error) {
+	primary, err := open(primaryAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	dbs := []*gorm.DB{primary}
+	closeAll := func() {
+		for _, db := range dbs {
+			if sqlDB, err := db.DB(); err == nil {
+				_ = sqlDB.Close()
+			}
+		}
+	}
+	for _, addr := range replicaAddrs {
+		replica, err := open(addr)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to open replica %s: %w", addr, err)
+		}
+		dbs = append(dbs, replica)
+	}
+
+	cluster, err := NewCluster(primary, dbs[1:], policy)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return cluster, nil
+}
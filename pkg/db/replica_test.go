@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+)
+
+func TestLeastLatencyPolicy(t *testing.T) {
+	var replicas []*gorm.DB
+	for _, name := range []string{"replica1", "replica2"} {
+		replicas = append(replicas, dbtest.NewSQLite(t, &db.SQLiteOptions{Path: name, InMemory: true}))
+	}
+
+	// replica1 的第一次查询很慢
+	slow := true
+	require.NoError(t, replicas[0].Callback().Query().After("gorm:query").Before("gorm:after_query").Register("test:slow", func(*gorm.DB) {
+		if slow {
+			slow = false
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	cluster, err := db.NewCluster(replicas[0], replicas, db.LeastLatencyPolicy{Exploration: 0.2})
+	require.NoError(t, err)
+
+	for _, replica := range cluster.Replicas() {
+		var n int
+		require.NoError(t, replica.DB().Raw("SELECT 1").Find(&n).Error)
+	}
+	assert.Greater(t, cluster.Replicas()[0].Latency(), cluster.Replicas()[1].Latency())
+
+	// replica1 恢复后仍然会被随机选中, 其延迟随之下降, 最终重新成为最快的从库
+	require.Eventually(t, func() bool {
+		var n int
+		if err := cluster.Replica().Raw("SELECT 1").Find(&n).Error; err != nil {
+			return false
+		}
+		return cluster.Replicas()[0].Latency() < 5*time.Millisecond
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestLeastLatencyPolicy_NoExploration(t *testing.T) {
+	var replicas []*gorm.DB
+	for _, name := range []string{"replica1", "replica2"} {
+		replicas = append(replicas, dbtest.NewSQLite(t, &db.SQLiteOptions{Path: name, InMemory: true}))
+	}
+	cluster, err := db.NewCluster(replicas[0], replicas, db.LeastLatencyPolicy{Exploration: -1})
+	require.NoError(t, err)
+
+	// 未服务过查询的从库优先被选中
+	var n int
+	require.NoError(t, replicas[0].Raw("SELECT 1").Find(&n).Error)
+	for range 100 {
+		assert.Same(t, replicas[1], cluster.Replica())
+	}
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SQLiteOptions defines options for SQLite database. SQLite needs no
+// external service, which makes it convenient for unit tests and small
+// deployments.
+type SQLiteOptions struct {
+	// Path is the path of the database file. With InMemory, it names the
+	// in-memory database instead, so that databases with different names are
+	// isolated from each other.
+	Path string
+	// InMemory keeps the database in memory, shared by the connections of the
+	// pool. The database is lost once it is closed, so connections are never
+	// recycled whatever MaxConnectionLifeTime.
+	// +optional
+	InMemory bool
+	// BusyTimeout is how long a statement waits for the database to be
+	// unlocked by another connection before failing.
+	// +optional
+	BusyTimeout           time.Duration
+	MaxIdleConnections    int
+	MaxOpenConnections    int
+	MaxConnectionLifeTime time.Duration
+	// +optional
+	Logger logger.Interface
+	// TracePlugin traces the statements and records their duration, if set.
+	// +optional
+	TracePlugin *TracePlugin
+}
+
+// DSN return DSN from SQLiteOptions.
+func (o *SQLiteOptions) DSN() string {
+	query := url.Values{}
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", o.BusyTimeout.Milliseconds()))
+	query.Add("_pragma", "foreign_keys(1)")
+
+	if o.InMemory {
+		query.Set("mode", "memory")
+		query.Set("cache", "shared")
+		return "file:" + o.Path + "?" + query.Encode()
+	}
+	return o.Path + "?" + query.Encode()
+}
+
+// NewSQLite create a new gorm db instance with the given options.
+func NewSQLite(opts *SQLiteOptions) (*gorm.DB, error) {
+	// Set default values to ensure all fields in opts are available.
+	setSQLiteDefaults(opts)
+
+	db, err := gorm.Open(sqlite.Open(opts.DSN()), &gorm.Config{
+		// PrepareStmt executes the given query in cached statement.
+		// This can improve performance.
+		PrepareStmt: true,
+		Logger:      opts.Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TracePlugin != nil {
+		if err := db.Use(opts.TracePlugin); err != nil {
+			return nil, err
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// SetMaxOpenConns sets the maximum number of open connections to the database.
+	sqlDB.SetMaxOpenConns(opts.MaxOpenConnections)
+
+	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+	// An in-memory database is deleted when its last connection is closed.
+	if opts.InMemory {
+		sqlDB.SetConnMaxLifetime(0)
+	} else {
+		sqlDB.SetConnMaxLifetime(opts.MaxConnectionLifeTime)
+	}
+
+	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
+	sqlDB.SetMaxIdleConns(opts.MaxIdleConnections)
+
+	return db, nil
+}
+
+// setSQLiteDefaults set available default values for some fields. SQLite
+// serializes writes, so a single connection is used by default.
+func setSQLiteDefaults(opts *SQLiteOptions) {
+	if opts.Path == "" {
+		if opts.InMemory {
+			opts.Path = "memdb"
+		} else {
+			opts.Path = "sqlite.db"
+		}
+	}
+	if opts.BusyTimeout == 0 {
+		opts.BusyTimeout = time.Duration(5) * time.Second
+	}
+	if opts.MaxIdleConnections == 0 {
+		opts.MaxIdleConnections = 1
+	}
+	if opts.MaxOpenConnections == 0 {
+		opts.MaxOpenConnections = 1
+	}
+	if opts.MaxConnectionLifeTime == 0 {
+		opts.MaxConnectionLifeTime = time.Duration(10) * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.Default
+	}
+}
@@ -0,0 +1,86 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+)
+
+// pragma 返回 SQLite 的 pragma 设置.
+func pragma(t *testing.T, gdb *gorm.DB, name string) int {
+	var value int
+	require.NoError(t, gdb.Raw("PRAGMA "+name).Scan(&value).Error)
+	return value
+}
+
+func TestSQLiteOptions_DSN(t *testing.T) {
+	opts := &db.SQLiteOptions{Path: "/tmp/app.db", BusyTimeout: 1500 * time.Millisecond}
+	assert.Equal(t, "/tmp/app.db?_pragma=busy_timeout%281500%29&_pragma=foreign_keys%281%29", opts.DSN())
+
+	opts = &db.SQLiteOptions{Path: "memdb", InMemory: true}
+	assert.Equal(t, "file:memdb?_pragma=busy_timeout%280%29&_pragma=foreign_keys%281%29&cache=shared&mode=memory", opts.DSN())
+}
+
+func TestNewSQLite_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	opts := &db.SQLiteOptions{Path: path, Logger: logger.Discard}
+	gdb, err := db.NewSQLite(opts)
+	require.NoError(t, err)
+
+	// 未设置的选项使用默认值
+	assert.Equal(t, 1, db.MustRawDB(gdb).Stats().MaxOpenConnections)
+	assert.Equal(t, 5000, pragma(t, gdb, "busy_timeout"))
+	assert.Equal(t, 1, pragma(t, gdb, "foreign_keys"))
+
+	require.NoError(t, gdb.AutoMigrate(&User{}))
+	require.NoError(t, gdb.Create(&User{Name: "alice"}).Error)
+	require.NoError(t, db.MustRawDB(gdb).Close())
+	assert.FileExists(t, path)
+
+	// 重新打开后数据仍然存在
+	gdb, err = db.NewSQLite(&db.SQLiteOptions{Path: path, Logger: logger.Discard})
+	require.NoError(t, err)
+	defer db.MustRawDB(gdb).Close()
+	var user User
+	require.NoError(t, gdb.First(&user).Error)
+	assert.Equal(t, "alice", user.Name)
+}
+
+func TestNewSQLite_InMemory(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	newDB := func(path string) *gorm.DB {
+		gdb, err := db.NewSQLite(&db.SQLiteOptions{Path: path, InMemory: true, MaxOpenConnections: 2, Logger: logger.Discard})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.MustRawDB(gdb).Close() })
+		return gdb
+	}
+
+	// 同名的内存数据库被所有连接共享
+	shared := newDB("shared")
+	require.NoError(t, shared.AutoMigrate(&User{}))
+	require.NoError(t, shared.Create(&User{Name: "alice"}).Error)
+
+	// 事务占用一个连接, 之后的查询使用另一个连接
+	tx := shared.Begin()
+	defer tx.Rollback()
+	var n int64
+	require.NoError(t, shared.Model(&User{}).Count(&n).Error)
+	assert.EqualValues(t, 1, n)
+	require.NoError(t, newDB("shared").Model(&User{}).Count(&n).Error)
+	assert.EqualValues(t, 1, n)
+
+	// 不同名的内存数据库相互隔离, 且不会写入文件
+	assert.False(t, newDB("other").Migrator().HasTable(&User{}))
+	entries, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
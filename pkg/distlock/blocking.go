@@ -0,0 +1,118 @@
+package distlock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// ExtendedLocker extends Locker with non-blocking and blocking acquisition.
+type ExtendedLocker interface {
+	Locker
+
+	// TryLock makes a single attempt to acquire the lock and returns at once.
+	// It returns an error wrapping ErrLockHeld if the lock is held by another owner.
+	TryLock(ctx context.Context) (int64, error)
+
+	// LockWait blocks until the lock is acquired or ctx is done.
+	LockWait(ctx context.Context) (int64, error)
+
+	// LockWithTimeout blocks until the lock is acquired or the timeout elapses.
+	LockWithTimeout(ctx context.Context, timeout time.Duration) (int64, error)
+}
+
+// BlockingLocker adds blocking acquisition on top of any Locker. Between two
+// attempts it waits according to the configured backoff, or less if the
+// underlying locker implements ReleaseNotifier and reports that the lock has
+// been released.
+type BlockingLocker struct {
+	Locker
+	backoff wait.Backoff
+	clock   clock.WithTicker
+	logger  logger.Logger
+}
+
+// Ensure BlockingLocker implements the ExtendedLocker interface.
+var _ ExtendedLocker = (*BlockingLocker)(nil)
+
+// NewBlockingLocker wraps the given locker in a BlockingLocker.
+// Only the backoff, clock and logger options are used.
+func NewBlockingLocker(locker Locker, opts ...Option) *BlockingLocker {
+	o := ApplyOptions(opts...)
+	return &BlockingLocker{
+		Locker:  locker,
+		backoff: o.backoff,
+		clock:   o.clock,
+		logger:  o.logger,
+	}
+}
+
+// TryLock makes a single attempt to acquire the lock.
+func (l *BlockingLocker) TryLock(ctx context.Context) (int64, error) {
+	return l.Locker.Lock(ctx)
+}
+
+// LockWait blocks until the lock is acquired or ctx is done.
+// Errors of individual attempts are logged and retried.
+func (l *BlockingLocker) LockWait(ctx context.Context) (int64, error) {
+	backoff := l.backoff
+	for {
+		token, err := l.wait(ctx, &backoff)
+		if err == nil {
+			return token, nil
+		}
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("failed to acquire lock: %w", ctx.Err())
+		}
+	}
+}
+
+// LockWithTimeout blocks until the lock is acquired or the timeout elapses.
+func (l *BlockingLocker) LockWithTimeout(ctx context.Context, timeout time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return l.LockWait(ctx)
+}
+
+// wait tries to acquire the lock once and, if that fails, waits for the next
+// backoff step or until the lock is released, whichever comes first.
+// If the locker supports release notifications, the subscription is made before
+// the attempt, so a release right after a failed attempt is not missed.
+func (l *BlockingLocker) wait(ctx context.Context, backoff *wait.Backoff) (int64, error) {
+	notifyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var released <-chan struct{}
+	if notifier, ok := l.Locker.(ReleaseNotifier); ok {
+		ch, err := notifier.NotifyRelease(notifyCtx)
+		if err != nil {
+			l.logger.Debug("Failed to subscribe to lock release", "error", err)
+		}
+		released = ch
+	}
+
+	token, err := l.Locker.Lock(ctx)
+	if err == nil {
+		return token, nil
+	}
+	l.logger.Debug("Failed to acquire lock, waiting", "error", err)
+
+	timer := l.clock.NewTimer(backoff.Step())
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-released:
+		// The lock has been released, so start over with a fresh backoff.
+		*backoff = l.backoff
+	case <-timer.C():
+	}
+
+	return 0, err
+}
@@ -13,19 +13,23 @@ import (
 
 // ConsulLocker is a structure that implements distributed locking using Consul.
 type ConsulLocker struct {
-	client      *api.Client   // Consul client for interacting with the Consul API
-	lockKey     string        // Key for the distributed lock
-	lockTimeout time.Duration // Duration for which the lock is valid
-	renewTicker *time.Ticker  // Ticker for renewing the lock periodically
-	stopChan    chan struct{} // Channel to signal stopping the renewal process
-	mu          sync.Mutex    // Mutex for synchronizing access to the locker
-	ownerID     string        // Identifier for the owner of the lock
-	logger      logger.Logger // Logger for logging events and errors
+	client          *api.Client   // Consul client for interacting with the Consul API
+	lockKey         string        // Key for the distributed lock
+	lockTimeout     time.Duration // Duration for which the lock is valid
+	keeper          *leaseKeeper  // Renews the lock while it is held
+	instrumentation *Instrumentation
+	mu              sync.Mutex    // Mutex for synchronizing access to the locker
+	ownerID         string        // Identifier for the owner of the lock
+	sessionID       string        // Session bound to the lock while it is held
+	logger          logger.Logger // Logger for logging events and errors
 }
 
 // Ensure ConsulLocker implements the Locker interface
 var _ Locker = (*ConsulLocker)(nil)
 
+// Ensure ConsulLocker implements the HolderInspector interface
+var _ HolderInspector = (*ConsulLocker)(nil)
+
 // NewConsulLocker creates a new ConsulLocker instance.
 func NewConsulLocker(consulAddr string, opts ...Option) (*ConsulLocker, error) {
 	o := ApplyOptions(opts...)
@@ -39,12 +43,13 @@ func NewConsulLocker(consulAddr string, opts ...Option) (*ConsulLocker, error) {
 
 	// Initialize a new ConsulLocker with the provided options
 	locker := &ConsulLocker{
-		client:      client,
-		lockKey:     o.lockName,
-		lockTimeout: o.lockTimeout,
-		stopChan:    make(chan struct{}),
-		ownerID:     o.ownerID,
-		logger:      o.logger,
+		client:          client,
+		lockKey:         o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
 	}
 
 	locker.logger.Info("ConsulLocker initialized", "lockKey", locker.lockKey, "ownerID", locker.ownerID)
@@ -52,7 +57,12 @@ func NewConsulLocker(consulAddr string, opts ...Option) (*ConsulLocker, error) {
 }
 
 // Lock attempts to acquire the distributed lock.
-func (l *ConsulLocker) Lock(ctx context.Context) error {
+func (l *ConsulLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockKey, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *ConsulLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -66,7 +76,7 @@ func (l *ConsulLocker) Lock(ctx context.Context) error {
 	sessionID, _, err := l.client.Session().Create(session, nil)
 	if err != nil {
 		l.logger.Error("Failed to create session", "error", err)
-		return fmt.Errorf("failed to create session: %v", err)
+		return 0, fmt.Errorf("failed to create session: %v", err)
 	}
 
 	// Create a KV pair for the lock
@@ -76,39 +86,86 @@ func (l *ConsulLocker) Lock(ctx context.Context) error {
 		Session: sessionID,
 	}
 
-	// Attempt to put the lock in the KV store and handle any errors
-	_, err = l.client.KV().Put(kv, nil)
+	// Attempt to acquire the lock in the KV store and handle any errors
+	acquired, _, err := l.client.KV().Acquire(kv, nil)
 	if err != nil {
+		_, _ = l.client.Session().Destroy(sessionID, nil)
 		l.logger.Error("Failed to acquire lock", "error", err)
-		return fmt.Errorf("failed to acquire lock: %v", err)
+		return 0, fmt.Errorf("failed to acquire lock: %v", err)
+	}
+	if !acquired {
+		_, _ = l.client.Session().Destroy(sessionID, nil)
+		l.logger.Warn("Lock is already held by another owner", "lockKey", l.lockKey)
+		return 0, fmt.Errorf("%w by another owner", ErrLockHeld)
 	}
 
-	// Start a ticker to renew the lock periodically
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx, sessionID)
+	// The modify index of the acquired key grows with every write to Consul,
+	// so it is used as the fencing token.
+	pair, _, err := l.client.KV().Get(l.lockKey, nil)
+	if err == nil && pair == nil {
+		err = fmt.Errorf("key %s not found", l.lockKey)
+	}
+	if err != nil {
+		// Destroying the session releases the lock
+		_, _ = l.client.Session().Destroy(sessionID, nil)
+		l.logger.Error("Failed to read acquired lock", "error", err)
+		return 0, fmt.Errorf("failed to read acquired lock: %v", err)
+	}
+	token := int64(pair.ModifyIndex)
 
-	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "sessionID", sessionID)
-	return nil
+	// Renew the lock periodically until it is released
+	l.sessionID = sessionID
+	l.keeper.start(ctx, l.Renew)
+
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "sessionID", sessionID, "token", token)
+	return token, nil
 }
 
 // Unlock releases the distributed lock.
 func (l *ConsulLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockKey, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *ConsulLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Stop the renewal ticker if it is running
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
+	if l.keeper.stop() {
 		l.logger.Info("Stopped renewing lock", "lockKey", l.lockKey)
 	}
 
-	// Delete the lock from the KV store and handle any errors
-	_, err := l.client.KV().Delete(l.lockKey, nil)
+	// Delete the lock from the KV store, but only if it is still bound to our
+	// session and has not changed since it was read
+	pair, _, err := l.client.KV().Get(l.lockKey, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		l.logger.Error("Failed to release lock", "error", err)
+		return fmt.Errorf("failed to release lock: %v", err)
+	}
+	// The session no longer guards the lock when it is lost, so it is
+	// destroyed on these paths too rather than left to expire
+	if pair == nil || pair.Session == "" {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		_, _ = l.client.Session().Destroy(l.sessionID, nil)
+		return ErrLockLost
+	}
+	if pair.Session != l.sessionID {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		_, _ = l.client.Session().Destroy(l.sessionID, nil)
+		return ErrNotOwner
+	}
+	deleted, _, err := l.client.KV().DeleteCAS(pair, (&api.WriteOptions{}).WithContext(ctx))
 	if err != nil {
 		l.logger.Error("Failed to release lock", "error", err)
 		return fmt.Errorf("failed to release lock: %v", err)
 	}
+	if !deleted {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		_, _ = l.client.Session().Destroy(l.sessionID, nil)
+		return ErrNotOwner
+	}
+	_, _ = l.client.Session().Destroy(l.sessionID, nil)
 
 	l.logger.Info("Lock released", "ownerID", l.ownerID)
 	return nil
@@ -116,31 +173,46 @@ func (l *ConsulLocker) Unlock(ctx context.Context) error {
 
 // Renew refreshes the lock's expiration time.
 func (l *ConsulLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockKey, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *ConsulLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Renew the session associated with the lock and handle any errors
-	_, _, err := l.client.Session().Renew(l.ownerID, nil)
+	entry, _, err := l.client.Session().Renew(l.sessionID, nil)
 	if err != nil {
 		l.logger.Error("Failed to renew lock", "error", err)
 		return fmt.Errorf("failed to renew lock: %v", err)
 	}
+	if entry == nil {
+		// The session has expired and the lock has been released with it
+		l.logger.Warn("Lock session no longer exists", "sessionID", l.sessionID)
+		return ErrLockLost
+	}
 
 	l.logger.Info("Lock renewed", "ownerID", l.ownerID)
 	return nil
 }
 
-// renewLock periodically renews the lock.
-func (l *ConsulLocker) renewLock(ctx context.Context, sessionID string) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			// Attempt to renew the lock and log any errors
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("Failed to renew lock", "error", err)
-			}
-		}
+// Holder implements HolderInspector. The lock is held as long as a session
+// is bound to the lock key.
+func (l *ConsulLocker) Holder(ctx context.Context) (string, int64, error) {
+	pair, _, err := l.client.KV().Get(l.lockKey, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+	if pair == nil || pair.Session == "" {
+		return "", 0, nil
 	}
+
+	return string(pair.Value), int64(pair.ModifyIndex), nil
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *ConsulLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
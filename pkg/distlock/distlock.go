@@ -3,9 +3,14 @@ package distlock
 
 import (
 	"context"
+	"errors"
+	"math"
 	"os"
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+
 	"github.com/LiangNing7/goutils/pkg/logger"
 	"github.com/LiangNing7/goutils/pkg/logger/empty"
 )
@@ -13,11 +18,27 @@ import (
 // DefaultLockName is the default name used for the distributed lock.
 const DefaultLockName = "onex-distributed-lock"
 
+var (
+	// ErrLockHeld is returned by Lock when the lock is held by another owner.
+	ErrLockHeld = errors.New("lock is already held")
+
+	// ErrNotOwner is returned when the lock is currently held by another owner,
+	// so the caller is not allowed to release or renew it.
+	ErrNotOwner = errors.New("lock is held by another owner")
+
+	// ErrLockLost is returned when the lock no longer exists, for example
+	// because its lease expired before it could be renewed.
+	ErrLockLost = errors.New("lock has been lost")
+)
+
 // Locker is an interface that defines the methods for a distributed lock.
 // It provides methods to acquire, release, and renew a lock in a distributed system.
 type Locker interface {
-	// Lock attempts to acquire the lock.
-	Lock(ctx context.Context) error
+	// Lock attempts to acquire the lock and returns the fencing token of this
+	// acquisition. Tokens are strictly increasing for every successful acquisition
+	// of the same lock, so the protected resource can reject writes from a holder
+	// whose lease has already expired. See Fence.
+	Lock(ctx context.Context) (int64, error)
 
 	// Unlock releases the previously acquired lock.
 	Unlock(ctx context.Context) error
@@ -25,14 +46,55 @@ type Locker interface {
 	// Renew updates the expiration time of the lock.
 	// It should be called periodically to keep the lock active.
 	Renew(ctx context.Context) error
+
+	// Lost returns a channel which is closed when the lock, once acquired, is
+	// lost because renewals kept failing past the lease deadline, or because the
+	// backend reported ErrLockLost or ErrNotOwner. Every acquisition gets a new
+	// channel, which is not closed by a regular Unlock.
+	Lost() <-chan struct{}
+}
+
+// ReleaseNotifier is implemented by lockers whose backend can push a
+// notification when the lock is released, so that waiters do not have to poll.
+type ReleaseNotifier interface {
+	// NotifyRelease returns a channel which is closed once the lock is released
+	// or expires. The channel is also closed when ctx is done.
+	NotifyRelease(ctx context.Context) (<-chan struct{}, error)
+}
+
+// RWLocker is a reader/writer lock. The write lock, taken with Lock, can be held
+// by a single owner. The read lock can be held by many owners at the same time,
+// but never together with the write lock of another owner. Renew and Lost cover
+// both the read and the write lock.
+type RWLocker interface {
+	Locker
+
+	// RLock attempts to acquire the read lock. It returns an error wrapping
+	// ErrLockHeld if the write lock is held by another owner.
+	RLock(ctx context.Context) error
+
+	// RUnlock releases the previously acquired read lock.
+	RUnlock(ctx context.Context) error
+}
+
+// HolderInspector is implemented by lockers which can tell who currently
+// holds the lock, e.g. to find out the leader of an election.
+type HolderInspector interface {
+	// Holder returns the owner ID and the fencing token of the current holder of
+	// the lock. The owner ID is empty if the lock is not held by anybody.
+	Holder(ctx context.Context) (ownerID string, token int64, err error)
 }
 
 // Options holds the configuration for the distributed lock.
 type Options struct {
-	lockName    string        // Name of the lock
-	lockTimeout time.Duration // Duration before the lock expires
-	ownerID     string        // Identifier for the lock owner
-	logger      logger.Logger // Logger for logging events
+	lockName        string           // Name of the lock
+	lockTimeout     time.Duration    // Duration before the lock expires
+	ownerID         string           // Identifier for the lock owner
+	logger          logger.Logger    // Logger for logging events
+	backoff         wait.Backoff     // Backoff between attempts of a blocking acquisition
+	capacity        int64            // Number of permits of a Semaphore
+	clock           clock.WithTicker // Clock used for leases and backoff
+	instrumentation *Instrumentation // Records metrics and traces, if set
 }
 
 // Option is a function that modifies Options.
@@ -46,6 +108,15 @@ func NewOptions() *Options {
 		lockTimeout: 10 * time.Second,  // Default lock timeout
 		ownerID:     ownerID,           // Set the owner ID
 		logger:      empty.NewLogger(), // Default logger
+		backoff: wait.Backoff{ // Default backoff for blocking acquisition
+			Duration: 100 * time.Millisecond,
+			Factor:   2,
+			Jitter:   0.2,
+			Steps:    math.MaxInt32,
+			Cap:      2 * time.Second,
+		},
+		capacity: 1,                 // Default semaphore capacity
+		clock:    clock.RealClock{}, // Default clock
 	}
 }
 
@@ -86,3 +157,36 @@ func WithLogger(logger logger.Logger) Option {
 		o.logger = logger // Set the logger
 	}
 }
+
+// WithBackoff sets the backoff used between acquisition attempts by LockWait.
+// Jitter is applied to every step, and Cap bounds the delay between attempts.
+func WithBackoff(backoff wait.Backoff) Option {
+	return func(o *Options) {
+		o.backoff = backoff // Set the backoff
+	}
+}
+
+// WithCapacity sets the number of permits of a Semaphore, that is how many
+// holders it admits at the same time.
+func WithCapacity(capacity int64) Option {
+	return func(o *Options) {
+		o.capacity = capacity // Set the capacity
+	}
+}
+
+// WithClock sets the clock used to renew leases and to wait between attempts
+// of a blocking acquisition. It is meant for tests, which can pass a fake clock
+// to control time, e.g. together with MemoryLocker.
+func WithClock(clock clock.WithTicker) Option {
+	return func(o *Options) {
+		o.clock = clock // Set the clock
+	}
+}
+
+// WithInstrumentation sets the Instrumentation recording metrics and traces
+// of lock operations. Nothing is recorded by default.
+func WithInstrumentation(instrumentation *Instrumentation) Option {
+	return func(o *Options) {
+		o.instrumentation = instrumentation // Set the instrumentation
+	}
+}
@@ -0,0 +1,515 @@
+// Package distlocktest provides a behavioural test suite for distlock.Locker
+// implementations.
+package distlocktest // import "github.com/LiangNing7/goutils/pkg/distlock/distlocktest"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+)
+
+// Backend describes the backend under test.
+type Backend struct {
+	// NewLocker creates a locker with the given options. The options set the
+	// lock name, owner ID, lock timeout and clock, and must be passed on to the
+	// constructor of the locker. More options may be appended to them.
+	NewLocker func(t *testing.T, opts ...distlock.Option) distlock.Locker
+
+	// Advance makes the given duration elapse for the backend, e.g. with
+	// miniredis.FastForward. Defaults to time.Sleep.
+	Advance func(t *testing.T, d time.Duration)
+
+	// LockTimeout is the lock timeout used by the suite. Defaults to 1 second.
+	LockTimeout time.Duration
+
+	// NewSemaphore creates a semaphore with the given options, which are
+	// passed like those of NewLocker and also set the capacity. The semaphore
+	// tests are skipped if it is nil.
+	NewSemaphore func(t *testing.T, opts ...distlock.Option) distlock.Semaphore
+
+	// Reentrant tells whether Lock succeeds when the lock is already held by
+	// the same locker. Otherwise it is expected to fail with ErrLockHeld.
+	Reentrant bool
+
+	// Interrupt makes every request to the backend fail, as if it were
+	// unreachable, until the returned function is called. The tests which
+	// need a backend failure are skipped if it is nil.
+	Interrupt func(t *testing.T) (restore func())
+}
+
+// Run runs the behavioural suite against the given backend. Every test uses
+// its own lock name, so the backend can be shared by all of them.
+func Run(t *testing.T, backend Backend) {
+	if backend.Advance == nil {
+		backend.Advance = func(t *testing.T, d time.Duration) { time.Sleep(d) }
+	}
+	if backend.LockTimeout == 0 {
+		backend.LockTimeout = time.Second
+	}
+
+	s := &suite{Backend: backend}
+	t.Run("MutualExclusion", s.testMutualExclusion)
+	t.Run("FencingToken", s.testFencingToken)
+	t.Run("FencingTokenAfterExpiry", s.testFencingTokenAfterExpiry)
+	t.Run("OwnerOnlyRelease", s.testOwnerOnlyRelease)
+	t.Run("Blocking", s.testBlocking)
+	t.Run("Expiry", s.testExpiry)
+	t.Run("Renewal", s.testRenewal)
+	t.Run("LeaseLost", s.testLeaseLost)
+	t.Run("Reentrancy", s.testReentrancy)
+	t.Run("RelockAfterLoss", s.testRelockAfterLoss)
+	t.Run("ReadWrite", s.testReadWrite)
+	t.Run("Semaphore", s.testSemaphore)
+	t.Run("Instrumentation", s.testInstrumentation)
+}
+
+type suite struct {
+	Backend
+}
+
+// newLocker creates a locker of the lock of the running test. Lockers created
+// with stopped set never renew their lease on their own, as if their process
+// had crashed or stalled.
+func (s *suite) newLocker(t *testing.T, ownerID string, stopped bool) distlock.Locker {
+	if stopped {
+		locker, _ := s.newStalledLocker(t, ownerID)
+		return locker
+	}
+
+	return s.NewLocker(t, s.options(t, ownerID)...)
+}
+
+// newStalledLocker creates a locker which only renews its lease when the
+// returned clock is stepped.
+func (s *suite) newStalledLocker(t *testing.T, ownerID string) (distlock.Locker, *clocktesting.FakeClock) {
+	clock := clocktesting.NewFakeClock(time.Now())
+	return s.NewLocker(t, append(s.options(t, ownerID), distlock.WithClock(clock))...), clock
+}
+
+// options returns the options of a locker of the lock of the running test.
+func (s *suite) options(t *testing.T, ownerID string) []distlock.Option {
+	return []distlock.Option{
+		distlock.WithLockName(strings.ReplaceAll(t.Name(), "/", "-")),
+		distlock.WithOwnerID(ownerID),
+		distlock.WithLockTimeout(s.LockTimeout),
+	}
+}
+
+// testMutualExclusion checks that concurrent owners never hold the lock at the
+// same time.
+func (s *suite) testMutualExclusion(t *testing.T) {
+	const owners, rounds = 4, 5
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var holders, acquired atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < owners; i++ {
+		locker := distlock.NewBlockingLocker(s.newLocker(t, fmt.Sprintf("owner-%d", i), false),
+			distlock.WithBackoff(wait.Backoff{Duration: 10 * time.Millisecond, Jitter: 1}))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				if _, err := locker.LockWait(ctx); err != nil {
+					return
+				}
+
+				if n := holders.Add(1); n != 1 {
+					t.Errorf("lock held by %d owners at the same time", n)
+				}
+				acquired.Add(1)
+				time.Sleep(5 * time.Millisecond)
+				holders.Add(-1)
+
+				assert.NoError(t, locker.Unlock(ctx))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, owners*rounds, acquired.Load())
+}
+
+// testFencingToken checks that every acquisition gets a greater token.
+func (s *suite) testFencingToken(t *testing.T) {
+	ctx := context.Background()
+	a, b := s.newLocker(t, "a", false), s.newLocker(t, "b", false)
+
+	var last int64
+	for _, locker := range []distlock.Locker{a, b, a} {
+		token, err := locker.Lock(ctx)
+		require.NoError(t, err)
+		assert.Greater(t, token, last)
+		last = token
+
+		require.NoError(t, locker.Unlock(ctx))
+	}
+}
+
+// testFencingTokenAfterExpiry checks that the token of a holder whose lease
+// expired is rejected by a Fence once the new holder has used its own, and
+// that Holder reports the token returned by Lock.
+func (s *suite) testFencingTokenAfterExpiry(t *testing.T) {
+	ctx := context.Background()
+	a, b := s.newLocker(t, "a", true), s.newLocker(t, "b", false)
+	fence := distlock.NewFence()
+
+	stale, err := a.Lock(ctx)
+	require.NoError(t, err)
+	require.NoError(t, fence.Check("resource", stale))
+
+	s.Advance(t, s.LockTimeout*3/2)
+
+	token, err := b.Lock(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, token, stale)
+	if inspector, ok := b.(distlock.HolderInspector); ok {
+		owner, current, err := inspector.Holder(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "b", owner)
+		assert.Equal(t, token, current)
+	}
+
+	require.NoError(t, fence.Check("resource", token))
+	assert.ErrorIs(t, fence.Check("resource", stale), distlock.ErrStaleToken)
+	assert.NoError(t, b.Unlock(ctx))
+}
+
+// testOwnerOnlyRelease checks that only the holder can release or renew the lock.
+func (s *suite) testOwnerOnlyRelease(t *testing.T) {
+	ctx := context.Background()
+	a, b := s.newLocker(t, "a", false), s.newLocker(t, "b", false)
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	_, err = b.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+	assert.ErrorIs(t, b.Unlock(ctx), distlock.ErrNotOwner)
+	assert.ErrorIs(t, b.Renew(ctx), distlock.ErrNotOwner)
+
+	// The lock must still be held by a
+	_, err = b.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+
+	require.NoError(t, a.Unlock(ctx))
+	assert.ErrorIs(t, a.Unlock(ctx), distlock.ErrLockLost)
+}
+
+// testBlocking checks that a BlockingLocker waits for the lock to be
+// released, and gives up when its context is done.
+func (s *suite) testBlocking(t *testing.T) {
+	ctx := context.Background()
+	a := s.newLocker(t, "a", false)
+	b := distlock.NewBlockingLocker(s.newLocker(t, "b", false),
+		distlock.WithBackoff(wait.Backoff{Duration: 10 * time.Millisecond}))
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	_, err = b.TryLock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+	_, err = b.LockWithTimeout(ctx, 50*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		_, err := b.LockWait(ctx)
+		acquired <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, a.Unlock(ctx))
+	require.NoError(t, <-acquired)
+	assert.NoError(t, b.Unlock(ctx))
+}
+
+// testExpiry checks that the lock of a holder which stops renewing it can be
+// taken over once its lease has expired.
+func (s *suite) testExpiry(t *testing.T) {
+	ctx := context.Background()
+	a, b := s.newLocker(t, "a", true), s.newLocker(t, "b", false)
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	_, err = b.Lock(ctx)
+	require.ErrorIs(t, err, distlock.ErrLockHeld)
+
+	s.Advance(t, s.LockTimeout*3/2)
+
+	_, err = b.Lock(ctx)
+	require.NoError(t, err)
+
+	err = a.Renew(ctx)
+	assert.True(t, errors.Is(err, distlock.ErrNotOwner) || errors.Is(err, distlock.ErrLockLost), "unexpected error: %v", err)
+	assert.NoError(t, b.Unlock(ctx))
+}
+
+// testRenewal checks that renewing the lock keeps it held past its timeout.
+func (s *suite) testRenewal(t *testing.T) {
+	ctx := context.Background()
+	a, b := s.newLocker(t, "a", true), s.newLocker(t, "b", false)
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		s.Advance(t, s.LockTimeout/2)
+		require.NoError(t, a.Renew(ctx))
+	}
+
+	_, err = b.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+	assert.NoError(t, a.Unlock(ctx))
+}
+
+// testLeaseLost checks that Lost is closed when the lease of the holder has
+// been taken over, but not when the lock is released.
+func (s *suite) testLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	a, clock := s.newStalledLocker(t, "a")
+	b := s.newLocker(t, "b", false)
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+	lost := a.Lost()
+
+	s.Advance(t, s.LockTimeout*3/2)
+	_, err = b.Lock(ctx)
+	require.NoError(t, err)
+
+	// The next renewal of a finds out that the lock belongs to b
+	clock.Step(s.LockTimeout / 2)
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease loss was not reported")
+	}
+
+	lost = b.Lost()
+	require.NoError(t, b.Unlock(ctx))
+	select {
+	case <-lost:
+		t.Fatal("lease loss reported on unlock")
+	default:
+	}
+}
+
+// testReentrancy checks what happens when the holder locks the lock again.
+func (s *suite) testReentrancy(t *testing.T) {
+	ctx := context.Background()
+	a, b := s.newLocker(t, "a", false), s.newLocker(t, "b", false)
+
+	token, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	if !s.Reentrant {
+		_, err = a.Lock(ctx)
+		assert.ErrorIs(t, err, distlock.ErrLockHeld)
+
+		require.NoError(t, a.Unlock(ctx))
+		_, err = b.Lock(ctx)
+		require.NoError(t, err)
+		assert.NoError(t, b.Unlock(ctx))
+		return
+	}
+
+	again, err := a.Lock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+
+	// The lock is held until it is unlocked as many times as it was locked
+	require.NoError(t, a.Unlock(ctx))
+	_, err = b.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+
+	require.NoError(t, a.Unlock(ctx))
+	_, err = b.Lock(ctx)
+	require.NoError(t, err)
+	assert.NoError(t, b.Unlock(ctx))
+}
+
+// testRelockAfterLoss checks that relocking a lock whose lease was declared
+// lost, while the backend still names the locker as its owner, starts a new
+// lease which is renewed and released like a fresh one.
+func (s *suite) testRelockAfterLoss(t *testing.T) {
+	if !s.Reentrant {
+		t.Skip("backend is not reentrant")
+	}
+	if s.Interrupt == nil {
+		t.Skip("backend cannot be interrupted")
+	}
+
+	ctx := context.Background()
+	a, clock := s.newStalledLocker(t, "a")
+	b := s.newLocker(t, "b", false)
+
+	token, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	// Renewals fail past the end of the lease, which the backend still keeps
+	s.interruptLease(t, a, clock)
+	_, err = b.Lock(ctx)
+	require.ErrorIs(t, err, distlock.ErrLockHeld)
+
+	again, err := a.Lock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+	select {
+	case <-a.Lost():
+		t.Fatal("new lease reported lost")
+	default:
+	}
+
+	// The new lease is renewed, so it is lost again when renewals fail
+	s.interruptLease(t, a, clock)
+
+	// The relock started a single hold, which one unlock releases
+	require.NoError(t, a.Unlock(ctx))
+	_, err = b.Lock(ctx)
+	require.NoError(t, err)
+	assert.NoError(t, b.Unlock(ctx))
+}
+
+// interruptLease interrupts the backend until the lease of the given stalled
+// locker is declared lost.
+func (s *suite) interruptLease(t *testing.T, locker distlock.Locker, clock *clocktesting.FakeClock) {
+	lost := locker.Lost()
+	restore := s.Interrupt(t)
+	defer restore()
+
+	clock.Step(s.LockTimeout)
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease loss was not reported")
+	}
+}
+
+// testReadWrite checks that read locks are shared between owners and
+// exclusive with the write lock. It is skipped for lockers which do not
+// implement distlock.RWLocker.
+func (s *suite) testReadWrite(t *testing.T) {
+	ctx := context.Background()
+	a, ok := s.newLocker(t, "a", false).(distlock.RWLocker)
+	if !ok {
+		t.Skip("locker does not implement distlock.RWLocker")
+	}
+	b := s.newLocker(t, "b", false).(distlock.RWLocker)
+	c := s.newLocker(t, "c", false).(distlock.RWLocker)
+
+	require.NoError(t, a.RLock(ctx))
+	require.NoError(t, b.RLock(ctx))
+	_, err := c.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+
+	// The write lock is available once all readers are gone
+	require.NoError(t, a.RUnlock(ctx))
+	_, err = c.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+	require.NoError(t, b.RUnlock(ctx))
+	_, err = c.Lock(ctx)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, a.RLock(ctx), distlock.ErrLockHeld)
+	require.NoError(t, c.Unlock(ctx))
+	require.NoError(t, a.RLock(ctx))
+	assert.NoError(t, a.RUnlock(ctx))
+}
+
+// testSemaphore checks that a semaphore admits at most its capacity, and that
+// the permits of a holder which stops renewing them expire.
+func (s *suite) testSemaphore(t *testing.T) {
+	if s.NewSemaphore == nil {
+		t.Skip("backend has no semaphore")
+	}
+
+	ctx := context.Background()
+	newSemaphore := func(ownerID string, opts ...distlock.Option) distlock.Semaphore {
+		opts = append(s.options(t, ownerID), append(opts,
+			distlock.WithCapacity(2),
+			distlock.WithBackoff(wait.Backoff{Duration: 10 * time.Millisecond}),
+		)...)
+		return s.NewSemaphore(t, opts...)
+	}
+	a, b := newSemaphore("a"), newSemaphore("b")
+
+	require.NoError(t, a.TryAcquire(ctx, 2))
+	assert.ErrorIs(t, b.TryAcquire(ctx, 1), distlock.ErrNoPermits)
+	assert.Error(t, b.TryAcquire(ctx, 3))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Acquire(timeoutCtx, 1), context.DeadlineExceeded)
+
+	require.NoError(t, a.Release(ctx, 1))
+	require.NoError(t, b.Acquire(ctx, 1))
+	assert.ErrorIs(t, b.TryAcquire(ctx, 1), distlock.ErrNoPermits)
+	require.NoError(t, a.Release(ctx, 1))
+	require.NoError(t, b.Release(ctx, 1))
+
+	// The permits of a stalled holder are available once their lease expired
+	stalled := newSemaphore("stalled", distlock.WithClock(clocktesting.NewFakeClock(time.Now())))
+	require.NoError(t, stalled.TryAcquire(ctx, 2))
+	assert.ErrorIs(t, a.TryAcquire(ctx, 1), distlock.ErrNoPermits)
+	s.Advance(t, s.LockTimeout*3/2)
+	require.NoError(t, a.TryAcquire(ctx, 2))
+	assert.NoError(t, a.Release(ctx, 2))
+}
+
+// testInstrumentation checks that the operations of the locker are recorded
+// by the Instrumentation passed with WithInstrumentation.
+func (s *suite) testInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	instrumentation, err := distlock.NewInstrumentation(registry)
+	require.NoError(t, err)
+	newLocker := func(ownerID string) distlock.Locker {
+		return s.NewLocker(t, append(s.options(t, ownerID), distlock.WithInstrumentation(instrumentation))...)
+	}
+	a, b := newLocker("a"), newLocker("b")
+
+	_, err = a.Lock(ctx)
+	require.NoError(t, err)
+	_, err = b.Lock(ctx)
+	require.ErrorIs(t, err, distlock.ErrLockHeld)
+	held, err := testutil.GatherAndCount(registry, "distlock_held")
+	require.NoError(t, err)
+	assert.Equal(t, 1, held)
+
+	require.NoError(t, a.Unlock(ctx))
+	held, err = testutil.GatherAndCount(registry, "distlock_held")
+	require.NoError(t, err)
+	assert.Zero(t, held)
+
+	// One acquired and one held attempt, one contention and one hold
+	expected := map[string]int{
+		"distlock_acquire_duration_seconds": 2,
+		"distlock_contention_total":         1,
+		"distlock_hold_duration_seconds":    1,
+	}
+	for name, count := range expected {
+		n, err := testutil.GatherAndCount(registry, name)
+		require.NoError(t, err)
+		assert.Equal(t, count, n, name)
+	}
+}
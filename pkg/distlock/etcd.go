@@ -2,10 +2,12 @@ package distlock
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"github.com/LiangNing7/goutils/pkg/logger"
@@ -13,21 +15,27 @@ import (
 
 // EtcdLocker provides a distributed locking mechanism using etcd.
 type EtcdLocker struct {
-	cli         *clientv3.Client
-	lease       clientv3.Lease
-	leaseID     clientv3.LeaseID
-	lockKey     string
-	lockTimeout time.Duration
-	renewTicker *time.Ticker
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	ownerID     string
-	logger      logger.Logger
+	cli             *clientv3.Client
+	lease           clientv3.Lease
+	leaseID         clientv3.LeaseID
+	lockKey         string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string
+	logger          logger.Logger
 }
 
 // Ensure EtcdLocker implements the Locker interface.
 var _ Locker = (*EtcdLocker)(nil)
 
+// Ensure EtcdLocker implements the ReleaseNotifier interface.
+var _ ReleaseNotifier = (*EtcdLocker)(nil)
+
+// Ensure EtcdLocker implements the HolderInspector interface.
+var _ HolderInspector = (*EtcdLocker)(nil)
+
 // NewEtcdLocker initializes a new EtcdLocker instance.
 func NewEtcdLocker(endpoints []string, opts ...Option) (*EtcdLocker, error) {
 	o := ApplyOptions(opts...)
@@ -43,56 +51,99 @@ func NewEtcdLocker(endpoints []string, opts ...Option) (*EtcdLocker, error) {
 	lease := clientv3.NewLease(cli)
 
 	locker := &EtcdLocker{
-		cli:         cli,
-		lease:       lease,
-		lockKey:     o.lockName,
-		lockTimeout: o.lockTimeout,
-		stopChan:    make(chan struct{}),
-		ownerID:     o.ownerID,
-		logger:      o.logger,
+		cli:             cli,
+		lease:           lease,
+		lockKey:         o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
 	}
 
 	return locker, nil
 }
 
 // Lock acquires the distributed lock.
-func (l *EtcdLocker) Lock(ctx context.Context) error {
+// The revision at which the lock key is created is used as the fencing token.
+func (l *EtcdLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockKey, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *EtcdLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	leaseResp, err := l.lease.Grant(ctx, int64(l.lockTimeout.Seconds()))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	l.leaseID = leaseResp.ID
-
-	_, err = l.cli.Put(ctx, l.lockKey, l.ownerID, clientv3.WithLease(leaseResp.ID))
+	resp, err := l.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(l.lockKey), "=", 0)).
+		Then(clientv3.OpPut(l.lockKey, l.ownerID, clientv3.WithLease(leaseResp.ID))).
+		Else(clientv3.OpGet(l.lockKey)).
+		Commit()
 	if err != nil {
-		return fmt.Errorf("failed to acquire lock: %v", err)
+		_, _ = l.lease.Revoke(context.Background(), leaseResp.ID)
+		return 0, fmt.Errorf("failed to acquire lock: %v", err)
+	}
+	if !resp.Succeeded {
+		_, _ = l.lease.Revoke(context.Background(), leaseResp.ID)
+		var currentOwnerID string
+		if kvs := resp.Responses[0].GetResponseRange().Kvs; len(kvs) > 0 {
+			currentOwnerID = string(kvs[0].Value)
+		}
+		l.logger.Warn("Lock is already held by another owner", "currentOwnerID", currentOwnerID)
+		return 0, fmt.Errorf("%w by %s", ErrLockHeld, currentOwnerID)
 	}
 
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx, leaseResp.ID)
+	l.leaseID = leaseResp.ID
+	token := resp.Header.Revision
 
-	l.logger.Info("Lock acquired", "lockKey", l.lockKey)
-	return nil
+	l.keeper.start(ctx, l.Renew)
+
+	l.logger.Info("Lock acquired", "lockKey", l.lockKey, "token", token)
+	return token, nil
 }
 
 // Unlock releases the distributed lock.
 func (l *EtcdLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockKey, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *EtcdLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
-	}
+	l.keeper.stop()
 
-	_, err := l.cli.Delete(ctx, l.lockKey)
+	// Delete the key only if it is still bound to our lease, so that a holder
+	// whose lease expired does not delete the lock of the new holder
+	resp, err := l.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.LeaseValue(l.lockKey), "=", l.leaseID)).
+		Then(clientv3.OpDelete(l.lockKey)).
+		Else(clientv3.OpGet(l.lockKey)).
+		Commit()
 	if err != nil {
 		return err
 	}
+	if !resp.Succeeded {
+		l.logger.Warn("Lock is no longer held by the current owner", "lockKey", l.lockKey)
+		// The lease no longer guards the lock, so it is revoked rather than
+		// left to expire
+		if l.leaseID != 0 {
+			if _, err := l.lease.Revoke(context.Background(), l.leaseID); err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+				l.logger.Warn("Failed to revoke lease", "lockKey", l.lockKey, "error", err)
+			}
+		}
+		if len(resp.Responses[0].GetResponseRange().Kvs) == 0 {
+			return ErrLockLost
+		}
+		return ErrNotOwner
+	}
 
 	if _, err := l.lease.Revoke(context.Background(), l.leaseID); err != nil {
 		return fmt.Errorf("failed to revoke lease: %w", err)
@@ -104,25 +155,66 @@ func (l *EtcdLocker) Unlock(ctx context.Context) error {
 
 // Renew refreshes the lease for the distributed lock.
 func (l *EtcdLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockKey, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *EtcdLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	_, err := l.lease.KeepAliveOnce(ctx, l.leaseID)
-	return err
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		// The lease has expired and the lock key has been deleted with it
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+
+	l.logger.Info("Lock renewed", "lockKey", l.lockKey)
+	return nil
 }
 
-// renewLock periodically renews the lock lease.
-func (l *EtcdLocker) renewLock(ctx context.Context, leaseID clientv3.LeaseID) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("failed to renew lock", "err", err)
-			} else {
-				l.logger.Info("Lock renewed", "lockKey", l.lockKey)
+// NotifyRelease implements ReleaseNotifier using an etcd watch on the lock key.
+func (l *EtcdLocker) NotifyRelease(ctx context.Context) (<-chan struct{}, error) {
+	watchChan := l.cli.Watch(ctx, l.lockKey)
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		for resp := range watchChan {
+			if err := resp.Err(); err != nil {
+				l.logger.Warn("Failed to watch lock", "lockKey", l.lockKey, "error", err)
+				return
+			}
+			for _, event := range resp.Events {
+				if event.Type == clientv3.EventTypeDelete {
+					return
+				}
 			}
 		}
+	}()
+
+	return released, nil
+}
+
+// Holder implements HolderInspector. The token is the revision at which the
+// lock key was created, the same as the one returned by Lock.
+func (l *EtcdLocker) Holder(ctx context.Context) (string, int64, error) {
+	resp, err := l.cli.Get(ctx, l.lockKey)
+	if err != nil {
+		return "", 0, err
 	}
+	if len(resp.Kvs) == 0 {
+		return "", 0, nil
+	}
+
+	return string(resp.Kvs[0].Value), resp.Kvs[0].CreateRevision, nil
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *EtcdLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
@@ -0,0 +1,66 @@
+package distlock
+
+import (
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrStaleToken is returned when a write carries a fencing token older than
+// a token the protected resource has already accepted.
+var ErrStaleToken = errors.New("stale fencing token")
+
+// Fence checks fencing tokens on the side of the protected resource.
+// It remembers the highest token accepted for every resource and rejects
+// any write that presents an older one.
+type Fence struct {
+	mu     sync.Mutex
+	tokens map[string]int64
+}
+
+// NewFence creates a new Fence instance.
+func NewFence() *Fence {
+	return &Fence{tokens: make(map[string]int64)}
+}
+
+// Check accepts the token for the given resource if it is not older than the
+// highest token accepted so far, otherwise it returns ErrStaleToken.
+func (f *Fence) Check(resource string, token int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if token < f.tokens[resource] {
+		return ErrStaleToken
+	}
+
+	f.tokens[resource] = token
+	return nil
+}
+
+// FencedUpdates updates the rows matched by db with the given values, but only
+// where the stored fencing token (kept in column) is not newer than token.
+// The column is set to token as part of the same statement. db must already
+// carry the model and conditions of the write, e.g.:
+//
+//	err := distlock.FencedUpdates(db.Model(&Job{}).Where("id = ?", id), "fencing_token", token, map[string]any{"status": "done"})
+//
+// ErrStaleToken is returned when no row was updated.
+func FencedUpdates(db *gorm.DB, column string, token int64, values map[string]any) error {
+	updates := make(map[string]any, len(values)+1)
+	for k, v := range values {
+		updates[k] = v
+	}
+	updates[column] = token
+
+	result := db.Where(clause.Lte{Column: clause.Column{Name: column}, Value: token}).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleToken
+	}
+
+	return nil
+}
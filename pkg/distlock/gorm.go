@@ -2,27 +2,33 @@ package distlock
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
-	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/LiangNing7/goutils/pkg/logger"
 )
 
 // GORMLocker provides a distributed locking mechanism using GORM.
+// It is reentrant: Lock and RLock may be called again while the lock is held,
+// and the lock is only released after the matching number of Unlock or RUnlock
+// calls. Hold counts are kept by the GORMLocker instance.
 type GORMLocker struct {
-	db          *gorm.DB
-	lockName    string
-	lockTimeout time.Duration
-	renewTicker *time.Ticker
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	ownerID     string
-	logger      logger.Logger
+	db              *gorm.DB
+	lockName        string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string
+	token           int64 // Fencing token of the write lock while it is held
+	holds           int   // Number of times the write lock is held
+	readHolds       int   // Number of times the read lock is held
+	logger          logger.Logger
 }
 
 // Lock represents a database record for a distributed lock.
@@ -30,6 +36,17 @@ type Lock struct {
 	ID        uint   `gorm:"primarykey"`
 	Name      string `gorm:"unique"`
 	OwnerID   string
+	Token     int64
+	ExpiredAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LockReader represents a database record for a holder of a read lock.
+type LockReader struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"size:255;uniqueIndex:idx_lock_reader"`
+	OwnerID   string `gorm:"size:255;uniqueIndex:idx_lock_reader"`
 	ExpiredAt time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -38,21 +55,28 @@ type Lock struct {
 // Ensure GORMLocker implements the Locker interface.
 var _ Locker = (*GORMLocker)(nil)
 
+// Ensure GORMLocker implements the RWLocker interface.
+var _ RWLocker = (*GORMLocker)(nil)
+
+// Ensure GORMLocker implements the HolderInspector interface.
+var _ HolderInspector = (*GORMLocker)(nil)
+
 // NewGORMLocker initializes a new GORMLocker instance.
 func NewGORMLocker(db *gorm.DB, opts ...Option) (*GORMLocker, error) {
 	o := ApplyOptions(opts...)
 
-	if err := db.AutoMigrate(&Lock{}); err != nil {
+	if err := db.AutoMigrate(&Lock{}, &LockReader{}); err != nil {
 		return nil, err
 	}
 
 	locker := &GORMLocker{
-		db:          db,
-		ownerID:     o.ownerID,
-		lockName:    o.lockName,
-		lockTimeout: o.lockTimeout,
-		stopChan:    make(chan struct{}),
-		logger:      o.logger,
+		db:              db,
+		ownerID:         o.ownerID,
+		lockName:        o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		logger:          o.logger,
 	}
 
 	locker.logger.Info("GORMLocker initialized", "lockName", locker.lockName, "ownerID", locker.ownerID)
@@ -61,64 +85,106 @@ func NewGORMLocker(db *gorm.DB, opts ...Option) (*GORMLocker, error) {
 }
 
 // Lock acquires the distributed lock.
-func (l *GORMLocker) Lock(ctx context.Context) error {
+// The lock record is kept after Unlock so that its fencing token keeps growing
+// across acquisitions. Writers and readers are serialized by locking the lock
+// record with SELECT ... FOR UPDATE.
+func (l *GORMLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockName, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *GORMLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	now := time.Now()
 	expiredAt := now.Add(l.lockTimeout)
 
-	err := l.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&Lock{Name: l.lockName, OwnerID: l.ownerID, ExpiredAt: expiredAt}).Error; err != nil {
-			if !isDuplicateEntry(err) {
-				l.logger.Error("failed to create lock", "error", err)
-				return err
-			}
-
-			var lock Lock
-			if err := tx.First(&lock, "name = ?", l.lockName).Error; err != nil {
-				l.logger.Error("failed to fetch existing lock", "error", err)
-				return err
-			}
-
-			if !lock.ExpiredAt.Before(now) {
-				l.logger.Warn("lock is already held by another owner", "ownerID", lock.OwnerID)
-				return fmt.Errorf("lock is already held by %s", lock.OwnerID)
-			}
+	var token int64
+	reentered := false
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		lock, err := l.lockRecord(tx)
+		if err != nil {
+			return err
+		}
 
-			lock.OwnerID = l.ownerID
-			lock.ExpiredAt = expiredAt
-			if err := tx.Save(&lock).Error; err != nil {
-				l.logger.Error("failed to update expired lock", "error", err)
-				return err
+		if lock.OwnerID != "" && !lock.ExpiredAt.Before(now) {
+			if lock.OwnerID == l.ownerID && l.holds > 0 && lock.Token == l.token {
+				token, reentered = lock.Token, true
+				return tx.Model(&Lock{}).Where("name = ?", l.lockName).Update("expired_at", expiredAt).Error
 			}
-			l.logger.Info("Lock expired, updated owner", "lockName", l.lockName, "newOwnerID", l.ownerID)
+			return fmt.Errorf("%w by %s", ErrLockHeld, lock.OwnerID)
 		}
 
-		l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-		go l.renewLock(ctx)
+		var readers int64
+		if err := tx.Model(&LockReader{}).Where("name = ? AND expired_at >= ?", l.lockName, now).Count(&readers).Error; err != nil {
+			return err
+		}
+		if readers > 0 {
+			return fmt.Errorf("%w by readers", ErrLockHeld)
+		}
 
-		l.logger.Info("Lock acquired", "lockName", l.lockName, "ownerID", l.ownerID)
-		return nil
+		token = lock.Token + 1
+		return tx.Model(&Lock{}).
+			Where("name = ?", l.lockName).
+			Updates(map[string]any{"owner_id": l.ownerID, "expired_at": expiredAt, "token": token}).Error
 	})
+	if errors.Is(err, ErrLockHeld) {
+		l.logger.Warn("lock is already held", "lockName", l.lockName, "error", err)
+		return 0, err
+	}
+	if err != nil {
+		l.logger.Error("failed to acquire lock", "error", err)
+		return 0, err
+	}
+	// A lease which has been declared lost is started over, since the lock
+	// still belongs to the caller but is no longer renewed.
+	if reentered && l.keeper.running() {
+		l.holds++
+		l.logger.Info("Lock is already held by the current owner", "lockName", l.lockName, "holds", l.holds)
+		return token, nil
+	}
 
-	return err
+	l.token = token
+	l.holds = 1
+	l.keeper.start(ctx, l.Renew)
+
+	l.logger.Info("Lock acquired", "lockName", l.lockName, "ownerID", l.ownerID, "token", token)
+	return token, nil
 }
 
 // Unlock releases the distributed lock.
 func (l *GORMLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockName, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *GORMLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
+	if l.holds > 1 {
+		l.holds--
+		l.logger.Info("Lock is still held by the current owner", "lockName", l.lockName, "holds", l.holds)
+		return nil
+	}
+	l.holds = 0
+	l.token = 0
+
+	if l.readHolds == 0 && l.keeper.stop() {
 		l.logger.Info("Stopped renewing lock", "lockName", l.lockName)
 	}
 
-	err := l.db.Delete(&Lock{}, "name = ?", l.lockName).Error
-	if err != nil {
-		l.logger.Error("failed to delete lock", "error", err)
+	result := l.db.WithContext(ctx).Model(&Lock{}).
+		Where("name = ? AND owner_id = ?", l.lockName, l.ownerID).
+		Updates(map[string]any{"owner_id": "", "expired_at": time.Now()})
+	if result.Error != nil {
+		l.logger.Error("failed to release lock", "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := l.ownershipError(ctx)
+		l.logger.Warn("lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
 		return err
 	}
 
@@ -128,15 +194,45 @@ func (l *GORMLocker) Unlock(ctx context.Context) error {
 
 // Renew refreshes the lease for the distributed lock.
 func (l *GORMLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockName, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *GORMLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	now := time.Now()
 	expiredAt := now.Add(l.lockTimeout)
 
-	err := l.db.Model(&Lock{}).Where("name = ?", l.lockName).Update("expired_at", expiredAt).Error
-	if err != nil {
-		l.logger.Error("failed to renew lock", "error", err)
+	if l.readHolds > 0 {
+		result := l.db.WithContext(ctx).Model(&LockReader{}).
+			Where("name = ? AND owner_id = ? AND expired_at >= ?", l.lockName, l.ownerID, now).
+			Update("expired_at", expiredAt)
+		if result.Error != nil {
+			l.logger.Error("failed to renew read lock", "error", result.Error)
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			l.logger.Warn("read lock is no longer held by the current owner", "lockName", l.lockName)
+			return ErrLockLost
+		}
+		if l.holds == 0 {
+			l.logger.Info("Read lock renewed", "lockName", l.lockName, "newExpiration", expiredAt)
+			return nil
+		}
+	}
+
+	result := l.db.WithContext(ctx).Model(&Lock{}).
+		Where("name = ? AND owner_id = ?", l.lockName, l.ownerID).
+		Update("expired_at", expiredAt)
+	if result.Error != nil {
+		l.logger.Error("failed to renew lock", "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := l.ownershipError(ctx)
+		l.logger.Warn("lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
 		return err
 	}
 
@@ -144,33 +240,143 @@ func (l *GORMLocker) Renew(ctx context.Context) error {
 	return nil
 }
 
-// renewLock periodically renews the lock lease.
-func (l *GORMLocker) renewLock(ctx context.Context) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("failed to renew lock", "error", err)
-			}
+// RLock acquires the read lock.
+func (l *GORMLocker) RLock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	expiredAt := now.Add(l.lockTimeout)
+
+	reentered := false
+	err := l.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		lock, err := l.lockRecord(tx)
+		if err != nil {
+			return err
+		}
+
+		if lock.OwnerID != "" && lock.OwnerID != l.ownerID && !lock.ExpiredAt.Before(now) {
+			return fmt.Errorf("%w by %s", ErrLockHeld, lock.OwnerID)
+		}
+
+		// Remove the readers whose lease has expired
+		if err := tx.Where("name = ? AND expired_at < ?", l.lockName, now).Delete(&LockReader{}).Error; err != nil {
+			return err
+		}
+
+		var live int64
+		if err := tx.Model(&LockReader{}).Where("name = ? AND owner_id = ?", l.lockName, l.ownerID).Count(&live).Error; err != nil {
+			return err
 		}
+		reentered = live > 0
+
+		reader := LockReader{Name: l.lockName, OwnerID: l.ownerID, ExpiredAt: expiredAt}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}, {Name: "owner_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"expired_at", "updated_at"}),
+		}).Create(&reader).Error
+	})
+	if errors.Is(err, ErrLockHeld) {
+		l.logger.Warn("lock is already held by a writer", "lockName", l.lockName, "error", err)
+		return err
 	}
+	if err != nil {
+		l.logger.Error("failed to acquire read lock", "error", err)
+		return err
+	}
+	if reentered && l.readHolds > 0 {
+		l.readHolds++
+		l.logger.Info("Read lock is already held by the current owner", "lockName", l.lockName, "readHolds", l.readHolds)
+		return nil
+	}
+
+	l.readHolds = 1
+	if l.holds == 0 {
+		l.keeper.start(ctx, l.Renew)
+	}
+
+	l.logger.Info("Read lock acquired", "lockName", l.lockName, "ownerID", l.ownerID)
+	return nil
 }
 
-// isDuplicateEntry checks if the error is a duplicate entry error for MySQL and PostgreSQL.
-func isDuplicateEntry(err error) bool {
-	if err == nil {
-		return false
+// RUnlock releases the read lock.
+func (l *GORMLocker) RUnlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.readHolds > 1 {
+		l.readHolds--
+		l.logger.Info("Read lock is still held by the current owner", "lockName", l.lockName, "readHolds", l.readHolds)
+		return nil
 	}
+	l.readHolds = 0
 
-	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
-		return mysqlErr.Number == 1062 // MySQL error code for duplicate entry
+	if l.holds == 0 && l.keeper.stop() {
+		l.logger.Info("Stopped renewing lock", "lockName", l.lockName)
+	}
+
+	result := l.db.WithContext(ctx).Where("name = ? AND owner_id = ?", l.lockName, l.ownerID).Delete(&LockReader{})
+	if result.Error != nil {
+		l.logger.Error("failed to release read lock", "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		l.logger.Warn("read lock is no longer held by the current owner", "lockName", l.lockName)
+		return ErrLockLost
+	}
+
+	l.logger.Info("Read lock released", "lockName", l.lockName)
+	return nil
+}
+
+// lockRecord reads the lock record with SELECT ... FOR UPDATE, creating it
+// first if it does not exist yet. It must be called within a transaction.
+func (l *GORMLocker) lockRecord(tx *gorm.DB) (*Lock, error) {
+	var lock Lock
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lock, "name = ?", l.lockName).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &lock, err
+	}
+
+	// A free lock has no owner. Its token starts at 0, so that the first writer gets 1.
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Lock{Name: l.lockName, ExpiredAt: time.Now()}).Error
+	if err != nil {
+		return nil, err
 	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lock, "name = ?", l.lockName).Error
+	return &lock, err
+}
 
-	if pgErr, ok := err.(*pgconn.PgError); ok {
-		return pgErr.Code == "23505" // PostgreSQL error code for unique violation
+// Holder implements HolderInspector by reading the lock record.
+func (l *GORMLocker) Holder(ctx context.Context) (string, int64, error) {
+	var lock Lock
+	err := l.db.WithContext(ctx).First(&lock, "name = ?", l.lockName).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if lock.OwnerID == "" || lock.ExpiredAt.Before(time.Now()) {
+		return "", 0, nil
 	}
 
-	return false
+	return lock.OwnerID, lock.Token, nil
+}
+
+// ownershipError tells why a conditional update of the lock record matched no
+// row: either another owner holds the lock, or the lock has been released.
+func (l *GORMLocker) ownershipError(ctx context.Context) error {
+	var lock Lock
+	err := l.db.WithContext(ctx).First(&lock, "name = ?", l.lockName).Error
+	if err == nil && lock.OwnerID != "" && lock.OwnerID != l.ownerID {
+		return ErrNotOwner
+	}
+	return ErrLockLost
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *GORMLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
@@ -0,0 +1,48 @@
+package distlock_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/distlock/distlocktest"
+)
+
+func TestGORMLocker(t *testing.T) {
+	// SQLite does not support SELECT ... FOR UPDATE, so the transactions are
+	// serialized by the single connection which db.NewSQLite opens by default.
+	db := dbtest.NewSQLite(t, nil)
+
+	// Queries and updates fail while interrupted, as if the database were down
+	var interrupted atomic.Bool
+	interrupt := func(db *gorm.DB) {
+		if interrupted.Load() {
+			_ = db.AddError(errors.New("database unavailable"))
+		}
+	}
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:interrupt", interrupt))
+	require.NoError(t, db.Callback().Update().Before("gorm:update").Register("test:interrupt", interrupt))
+
+	distlocktest.Run(t, distlocktest.Backend{
+		NewLocker: func(t *testing.T, opts ...distlock.Option) distlock.Locker {
+			locker, err := distlock.NewGORMLocker(db, opts...)
+			require.NoError(t, err)
+			return locker
+		},
+		NewSemaphore: func(t *testing.T, opts ...distlock.Option) distlock.Semaphore {
+			semaphore, err := distlock.NewGORMSemaphore(db, opts...)
+			require.NoError(t, err)
+			return semaphore
+		},
+		Reentrant: true,
+		Interrupt: func(t *testing.T) func() {
+			interrupted.Store(true)
+			return func() { interrupted.Store(false) }
+		},
+	})
+}
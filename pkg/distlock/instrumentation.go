@@ -0,0 +1,187 @@
+package distlock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer used by Instrumentation.
+const instrumentationName = "github.com/LiangNing7/goutils/pkg/distlock"
+
+// Instrumentation records Prometheus metrics and OpenTelemetry spans for the
+// operations of lockers created with WithInstrumentation. Spans are created
+// with the global tracer provider, e.g. the one set by
+// options.JaegerOptions.SetTracerProvider. A nil *Instrumentation records
+// nothing.
+type Instrumentation struct {
+	tracer          trace.Tracer
+	acquireDuration *prometheus.HistogramVec
+	contention      *prometheus.CounterVec
+	renewFailures   *prometheus.CounterVec
+	holdDuration    *prometheus.HistogramVec
+	holders         *prometheus.GaugeVec
+}
+
+// NewInstrumentation creates a new Instrumentation instance and registers its
+// metrics with the given registerer. Metrics already registered by a previous
+// instance are shared with it.
+func NewInstrumentation(registerer prometheus.Registerer) (*Instrumentation, error) {
+	i := &Instrumentation{
+		tracer: otel.Tracer(instrumentationName),
+		acquireDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "distlock",
+			Name:      "acquire_duration_seconds",
+			Help:      "Duration of single attempts to acquire a lock, by result (acquired, held or error).",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"lock", "result"}),
+		contention: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "distlock",
+			Name:      "contention_total",
+			Help:      "Number of attempts to acquire a lock which failed because the lock was held.",
+		}, []string{"lock"}),
+		renewFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "distlock",
+			Name:      "renew_failures_total",
+			Help:      "Number of failed lock renewals.",
+		}, []string{"lock"}),
+		holdDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "distlock",
+			Name:      "hold_duration_seconds",
+			Help:      "Duration for which a lock was held, until it was released or lost.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 4, 10),
+		}, []string{"lock"}),
+		holders: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "distlock",
+			Name:      "held",
+			Help:      "Set to 1 while the lock is held by the owner.",
+		}, []string{"lock", "owner"}),
+	}
+
+	errs := []error{
+		register(registerer, &i.acquireDuration),
+		register(registerer, &i.contention),
+		register(registerer, &i.renewFailures),
+		register(registerer, &i.holdDuration),
+		register(registerer, &i.holders),
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// register registers the collector, or replaces it with the equal collector
+// which is already registered.
+func register[T prometheus.Collector](registerer prometheus.Registerer, collector *T) error {
+	err := registerer.Register(*collector)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			*collector = existing
+			return nil
+		}
+	}
+	return err
+}
+
+// lock runs the given acquisition of a lock within a span and records its
+// duration and result.
+func (i *Instrumentation) lock(ctx context.Context, lockName, ownerID string, lock func(ctx context.Context) (int64, error)) (int64, error) {
+	if i == nil {
+		return lock(ctx)
+	}
+
+	ctx, span := i.start(ctx, "Lock", lockName, ownerID)
+	defer span.End()
+
+	start := time.Now()
+	token, err := lock(ctx)
+
+	result := "acquired"
+	switch {
+	case errors.Is(err, ErrLockHeld):
+		result = "held"
+		i.contention.WithLabelValues(lockName).Inc()
+		span.SetAttributes(attribute.Bool("distlock.held", true))
+	case err != nil:
+		result = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	default:
+		span.SetAttributes(attribute.Int64("distlock.token", token))
+	}
+	i.acquireDuration.WithLabelValues(lockName, result).Observe(time.Since(start).Seconds())
+
+	return token, err
+}
+
+// unlock runs the given release of a lock within a span.
+func (i *Instrumentation) unlock(ctx context.Context, lockName, ownerID string, unlock func(ctx context.Context) error) error {
+	if i == nil {
+		return unlock(ctx)
+	}
+
+	ctx, span := i.start(ctx, "Unlock", lockName, ownerID)
+	defer span.End()
+
+	err := unlock(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// renew runs the given renewal of a lock within a span and counts failures.
+func (i *Instrumentation) renew(ctx context.Context, lockName, ownerID string, renew func(ctx context.Context) error) error {
+	if i == nil {
+		return renew(ctx)
+	}
+
+	ctx, span := i.start(ctx, "Renew", lockName, ownerID)
+	defer span.End()
+
+	err := renew(ctx)
+	if err != nil {
+		i.renewFailures.WithLabelValues(lockName).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// acquired records that the lock is now held by the owner.
+func (i *Instrumentation) acquired(lockName, ownerID string) {
+	if i == nil {
+		return
+	}
+
+	i.holders.WithLabelValues(lockName, ownerID).Set(1)
+}
+
+// released records that the lock, held for the given duration, is no longer
+// held by the owner.
+func (i *Instrumentation) released(lockName, ownerID string, held time.Duration) {
+	if i == nil {
+		return
+	}
+
+	i.holders.DeleteLabelValues(lockName, ownerID)
+	i.holdDuration.WithLabelValues(lockName).Observe(held.Seconds())
+}
+
+// start starts a span for the given operation.
+func (i *Instrumentation) start(ctx context.Context, operation, lockName, ownerID string) (context.Context, trace.Span) {
+	return i.tracer.Start(ctx, "distlock."+operation, trace.WithAttributes(
+		attribute.String("distlock.lock", lockName),
+		attribute.String("distlock.owner", ownerID),
+	))
+}
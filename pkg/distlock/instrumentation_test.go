@@ -0,0 +1,80 @@
+package distlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+)
+
+func TestInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	instrumentation, err := distlock.NewInstrumentation(registry)
+	require.NoError(t, err)
+
+	// 重复创建时复用已注册的指标
+	_, err = distlock.NewInstrumentation(registry)
+	require.NoError(t, err)
+
+	locks := distlock.NewMemoryRegistry()
+	clock := clocktesting.NewFakeClock(time.Now())
+	newLocker := func(owner string) *distlock.MemoryLocker {
+		return distlock.NewMemoryLocker(locks,
+			distlock.WithLockName("metrics"),
+			distlock.WithOwnerID(owner),
+			distlock.WithClock(clock),
+			distlock.WithInstrumentation(instrumentation),
+		)
+	}
+	a, b := newLocker("a"), newLocker("b")
+
+	_, err = a.Lock(ctx)
+	require.NoError(t, err)
+	_, err = b.Lock(ctx)
+	require.ErrorIs(t, err, distlock.ErrLockHeld)
+	assert.ErrorIs(t, b.Renew(ctx), distlock.ErrNotOwner)
+
+	assert.Equal(t, 1.0, gather(t, registry)["distlock_held"])
+
+	clock.Step(time.Second)
+	require.NoError(t, a.Unlock(ctx))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(registry, "distlock_acquire_duration_seconds"))
+	assert.Equal(t, 0, testutil.CollectAndCount(registry, "distlock_held"))
+
+	values := gather(t, registry)
+	assert.Equal(t, 1.0, values["distlock_contention_total"])
+	assert.Equal(t, 1.0, values["distlock_renew_failures_total"])
+	assert.Equal(t, 1.0, values["distlock_hold_duration_seconds"])
+}
+
+// gather 返回注册表中各指标的值，直方图取样本之和。
+func gather(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetCounter() != nil:
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				values[family.GetName()] += metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] += metric.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,142 @@
+package distlock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// leaseKeeper renews a held lock in the background and reports when the lock
+// is lost. It is shared by all Locker implementations.
+type leaseKeeper struct {
+	lockName        string
+	ownerID         string
+	lockTimeout     time.Duration
+	clock           clock.WithTicker
+	instrumentation *Instrumentation
+	logger          logger.Logger
+
+	mu     sync.Mutex
+	stopCh chan struct{} // Closed to stop renewing the current lease
+	lostCh chan struct{} // Closed when the current lease is lost
+	heldAt time.Time     // When the current lease started
+}
+
+// newLeaseKeeper creates a new leaseKeeper instance.
+func newLeaseKeeper(o *Options) *leaseKeeper {
+	return &leaseKeeper{
+		lockName:        o.lockName,
+		ownerID:         o.ownerID,
+		lockTimeout:     o.lockTimeout,
+		clock:           o.clock,
+		instrumentation: o.instrumentation,
+		logger:          o.logger,
+		lostCh:          make(chan struct{}),
+	}
+}
+
+// start begins renewing a newly acquired lock every half lock timeout,
+// replacing any previous lease. The renewal keeps running after ctx is
+// cancelled, until stop is called or the lock is lost.
+func (k *leaseKeeper) start(ctx context.Context, renew func(ctx context.Context) error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.stopCh != nil {
+		close(k.stopCh)
+		k.release()
+	}
+	k.stopCh = make(chan struct{})
+	k.lostCh = make(chan struct{})
+	k.heldAt = k.clock.Now()
+	k.instrumentation.acquired(k.lockName, k.ownerID)
+
+	// The ticker is created here rather than in run, so that the lease starts
+	// as soon as start returns, which matters when the clock is a fake one.
+	ticker := k.clock.NewTicker(k.lockTimeout / 2)
+	deadline := k.clock.Now().Add(k.lockTimeout)
+	go k.run(context.WithoutCancel(ctx), renew, ticker, deadline, k.stopCh, k.lostCh)
+}
+
+// stop stops renewing the current lease. It returns false if no lease is
+// being renewed.
+func (k *leaseKeeper) stop() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.stopCh == nil {
+		return false
+	}
+	close(k.stopCh)
+	k.stopCh = nil
+	k.release()
+	return true
+}
+
+// running reports whether a lease is being renewed.
+func (k *leaseKeeper) running() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.stopCh != nil
+}
+
+// lost returns a channel which is closed when the current lease is lost.
+func (k *leaseKeeper) lost() <-chan struct{} {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.lostCh
+}
+
+// run renews the lock until stopCh is closed. The lock is considered lost when
+// the backend reports that it belongs to nobody or to someone else, or when
+// renewals keep failing past the end of the last successfully renewed lease.
+func (k *leaseKeeper) run(ctx context.Context, renew func(ctx context.Context) error, ticker clock.Ticker, deadline time.Time, stopCh, lostCh chan struct{}) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C():
+			now := k.clock.Now()
+			err := renew(ctx)
+			if err == nil {
+				deadline = now.Add(k.lockTimeout)
+				continue
+			}
+
+			k.logger.Error("Failed to renew lock", "error", err)
+			if errors.Is(err, ErrLockLost) || errors.Is(err, ErrNotOwner) || !now.Before(deadline) {
+				k.logger.Warn("Lock lost", "error", err)
+				k.markLost(stopCh, lostCh)
+				return
+			}
+		}
+	}
+}
+
+// markLost closes lostCh and forgets the lease, unless the lease has been
+// stopped or replaced in the meantime.
+func (k *leaseKeeper) markLost(stopCh, lostCh chan struct{}) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.stopCh != stopCh {
+		return
+	}
+	k.stopCh = nil
+	k.release()
+	close(lostCh)
+}
+
+// release records the end of the current lease. The caller must hold k.mu.
+func (k *leaseKeeper) release() {
+	k.instrumentation.released(k.lockName, k.ownerID, k.clock.Since(k.heldAt))
+}
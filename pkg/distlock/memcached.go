@@ -3,6 +3,8 @@ package distlock
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,30 +15,34 @@ import (
 
 // MemcachedLocker provides a distributed locking mechanism using Memcached.
 type MemcachedLocker struct {
-	client      *memcache.Client
-	lockKey     string
-	lockTimeout time.Duration
-	renewTicker *time.Ticker
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	ownerID     string
-	logger      logger.Logger
+	client          *memcache.Client
+	lockKey         string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string
+	logger          logger.Logger
 }
 
 // Ensure MemcachedLocker implements the Locker interface.
 var _ Locker = (*MemcachedLocker)(nil)
 
+// Ensure MemcachedLocker implements the HolderInspector interface.
+var _ HolderInspector = (*MemcachedLocker)(nil)
+
 // NewMemcachedLocker creates a new MemcachedLocker instance.
 func NewMemcachedLocker(memcachedAddr string, opts ...Option) *MemcachedLocker {
 	o := ApplyOptions(opts...)
 	client := memcache.New(memcachedAddr)
 	locker := &MemcachedLocker{
-		client:      client,
-		lockKey:     o.lockName,
-		lockTimeout: o.lockTimeout,
-		stopChan:    make(chan struct{}),
-		ownerID:     o.ownerID,
-		logger:      o.logger,
+		client:          client,
+		lockKey:         o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
 	}
 
 	locker.logger.Info("MemcachedLocker initialized", "lockKey", locker.lockKey, "ownerID", locker.ownerID)
@@ -44,7 +50,18 @@ func NewMemcachedLocker(memcachedAddr string, opts ...Option) *MemcachedLocker {
 }
 
 // Lock attempts to acquire the distributed lock.
-func (l *MemcachedLocker) Lock(ctx context.Context) error {
+// The fencing token is taken from a counter stored next to the lock key. The
+// counter never expires, but Memcached may still evict it under memory
+// pressure, so it is created from the current time in microseconds rather
+// than from zero: a counter recreated after an eviction starts above every
+// token issued before, as long as the lock was acquired less than a million
+// times per second on average and the clocks of the lockers are in sync.
+func (l *MemcachedLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockKey, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *MemcachedLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -59,35 +76,62 @@ func (l *MemcachedLocker) Lock(ctx context.Context) error {
 	err := l.client.Add(item)
 	if err == memcache.ErrNotStored {
 		l.logger.Warn("Lock is already held by another owner", "lockKey", l.lockKey)
-		return fmt.Errorf("lock is already held by another owner")
+		return 0, fmt.Errorf("%w by another owner", ErrLockHeld)
 	} else if err != nil {
 		l.logger.Error("Failed to acquire lock", "error", err)
-		return fmt.Errorf("failed to acquire lock: %v", err)
+		return 0, fmt.Errorf("failed to acquire lock: %v", err)
+	}
+
+	token, err := l.nextToken()
+	if err != nil {
+		_ = l.client.Delete(l.lockKey)
+		l.logger.Error("Failed to generate fencing token", "error", err)
+		return 0, fmt.Errorf("failed to generate fencing token: %v", err)
 	}
 
 	// Start the renewal goroutine
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx)
+	l.keeper.start(ctx, l.Renew)
 
-	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "lockKey", l.lockKey)
-	return nil
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "lockKey", l.lockKey, "token", token)
+	return int64(token), nil
 }
 
 // Unlock releases the distributed lock.
 func (l *MemcachedLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockKey, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *MemcachedLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Stop renewing the lock
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
+	if l.keeper.stop() {
 		l.logger.Info("Stopped renewing lock", "lockKey", l.lockKey)
 	}
 
-	// Remove the lock
-	err := l.client.Delete(l.lockKey)
-	if err != nil {
+	// Remove the lock, but only if it still belongs to us. Memcached has no
+	// conditional delete, so the lock is first expired with CompareAndSwap,
+	// which fails if the lock has been changed since we fetched it.
+	item, err := l.client.Get(l.lockKey)
+	if err == memcache.ErrCacheMiss {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		return ErrLockLost
+	} else if err != nil {
+		l.logger.Error("Failed to release lock", "error", err)
+		return fmt.Errorf("failed to release lock: %v", err)
+	}
+	if string(item.Value) != l.ownerID {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		return ErrNotOwner
+	}
+	item.Expiration = -1
+	if err := l.client.CompareAndSwap(item); err != nil {
+		if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+			l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+			return ErrLockLost
+		}
 		l.logger.Error("Failed to release lock", "error", err)
 		return fmt.Errorf("failed to release lock: %v", err)
 	}
@@ -98,21 +142,35 @@ func (l *MemcachedLocker) Unlock(ctx context.Context) error {
 
 // Renew refreshes the expiration time of the lock.
 func (l *MemcachedLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockKey, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *MemcachedLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	// Attempt to renew the lock
-	item := &memcache.Item{
-		Key:        l.lockKey,
-		Value:      []byte(l.ownerID),
-		Expiration: int32(l.lockTimeout.Seconds()),
+	// Fetch the lock to make sure it still belongs to us
+	item, err := l.client.Get(l.lockKey)
+	if err == memcache.ErrCacheMiss {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		return ErrLockLost
+	} else if err != nil {
+		l.logger.Error("Failed to renew lock", "error", err)
+		return fmt.Errorf("failed to renew lock: %v", err)
+	}
+	if string(item.Value) != l.ownerID {
+		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
+		return ErrNotOwner
 	}
 
-	// Use Replace method to update the expiration time of the lock
-	err := l.client.Replace(item)
-	if err == memcache.ErrNotStored {
+	// Use CompareAndSwap to update the expiration time of the lock, which fails
+	// if the lock has been changed since we fetched it
+	item.Expiration = int32(l.lockTimeout.Seconds())
+	err = l.client.CompareAndSwap(item)
+	if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
 		l.logger.Warn("Lock is not held by this owner anymore", "lockKey", l.lockKey)
-		return fmt.Errorf("lock is not held by this owner anymore")
+		return ErrLockLost
 	} else if err != nil {
 		l.logger.Error("Failed to renew lock", "error", err)
 		return fmt.Errorf("failed to renew lock: %v", err)
@@ -122,16 +180,53 @@ func (l *MemcachedLocker) Renew(ctx context.Context) error {
 	return nil
 }
 
-// renewLock periodically renews the lock.
-func (l *MemcachedLocker) renewLock(ctx context.Context) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("Failed to renew lock", "error", err)
-			}
-		}
+// Holder implements HolderInspector. Memcached cannot read the lock key and
+// the fencing counter atomically, so the token may be newer than the one of
+// the returned owner if the lock changes hands in between.
+func (l *MemcachedLocker) Holder(ctx context.Context) (string, int64, error) {
+	items, err := l.client.GetMulti([]string{l.lockKey, l.fencingKey()})
+	if err != nil {
+		return "", 0, err
+	}
+	item, ok := items[l.lockKey]
+	if !ok {
+		return "", 0, nil
 	}
+
+	var token int64
+	if counter, ok := items[l.fencingKey()]; ok {
+		token, _ = strconv.ParseInt(strings.TrimSpace(string(counter.Value)), 10, 64)
+	}
+	return string(item.Value), token, nil
+}
+
+// nextToken increments the fencing counter of the lock, creating it from the
+// current time if needed.
+func (l *MemcachedLocker) nextToken() (uint64, error) {
+	fencingKey := l.fencingKey()
+	token, err := l.client.Increment(fencingKey, 1)
+	if err != memcache.ErrCacheMiss {
+		return token, err
+	}
+
+	// The counter does not exist yet or has been evicted. Another instance may
+	// create it at the same time, in which case Add fails and we simply
+	// increment again.
+	floor := strconv.FormatInt(time.Now().UnixMicro(), 10)
+	err = l.client.Add(&memcache.Item{Key: fencingKey, Value: []byte(floor)})
+	if err != nil && err != memcache.ErrNotStored {
+		return 0, err
+	}
+	return l.client.Increment(fencingKey, 1)
+}
+
+// fencingKey returns the key of the fencing counter for the lock.
+func (l *MemcachedLocker) fencingKey() string {
+	return l.lockKey + ":fencing"
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *MemcachedLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
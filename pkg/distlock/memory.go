@@ -0,0 +1,260 @@
+package distlock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// MemoryRegistry holds the state of in-process locks. All MemoryLockers
+// created with the same registry share their locks, as if they were instances
+// talking to the same backend.
+type MemoryRegistry struct {
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}
+
+// memoryLock is the state of a single lock in a MemoryRegistry.
+type memoryLock struct {
+	ownerID   string
+	token     int64 // Fencing counter, the token of the current or last holder
+	expiredAt time.Time
+	released  chan struct{} // Closed when the lock is released
+}
+
+// NewMemoryRegistry creates a new, empty MemoryRegistry instance.
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{locks: make(map[string]*memoryLock)}
+}
+
+// lock returns the state of the named lock, creating it if needed.
+// The caller must hold r.mu.
+func (r *MemoryRegistry) lock(name string) *memoryLock {
+	lock, ok := r.locks[name]
+	if !ok {
+		lock = &memoryLock{released: make(chan struct{})}
+		r.locks[name] = lock
+	}
+	return lock
+}
+
+// MemoryLocker provides an in-process locking mechanism, mainly for tests.
+// Unlike NoopLocker it behaves like a real backend: lockers sharing a
+// MemoryRegistry contend for the same locks, and leases expire according to
+// the clock set with WithClock, so that tests can trigger expiry by advancing
+// a fake clock. Like RedisLocker, it is reentrant.
+type MemoryLocker struct {
+	registry        *MemoryRegistry
+	lockName        string
+	lockTimeout     time.Duration
+	clock           clock.WithTicker
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string
+	token           int64 // Fencing token of the lock while it is held
+	holds           int   // Number of times the lock is held
+	logger          logger.Logger
+}
+
+// Ensure MemoryLocker implements the Locker interface.
+var _ Locker = (*MemoryLocker)(nil)
+
+// Ensure MemoryLocker implements the ReleaseNotifier interface.
+var _ ReleaseNotifier = (*MemoryLocker)(nil)
+
+// Ensure MemoryLocker implements the HolderInspector interface.
+var _ HolderInspector = (*MemoryLocker)(nil)
+
+// NewMemoryLocker creates a new MemoryLocker instance sharing the locks of
+// the given registry.
+func NewMemoryLocker(registry *MemoryRegistry, opts ...Option) *MemoryLocker {
+	o := ApplyOptions(opts...)
+	locker := &MemoryLocker{
+		registry:        registry,
+		lockName:        o.lockName,
+		lockTimeout:     o.lockTimeout,
+		clock:           o.clock,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
+	}
+
+	locker.logger.Info("MemoryLocker initialized", "lockName", locker.lockName, "ownerID", locker.ownerID)
+	return locker
+}
+
+// Lock attempts to acquire the lock.
+func (l *MemoryLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockName, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *MemoryLocker) lock(ctx context.Context) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.registry.mu.Lock()
+	lock := l.registry.lock(l.lockName)
+	now := l.clock.Now()
+	if l.held(lock, now) {
+		if lock.ownerID == l.ownerID && l.holds > 0 && lock.token == l.token {
+			lock.expiredAt = now.Add(l.lockTimeout)
+			l.registry.mu.Unlock()
+
+			// A lease which has been declared lost is started over, since the
+			// lock still belongs to the caller but is no longer renewed.
+			if !l.keeper.running() {
+				l.holds = 1
+				l.keeper.start(ctx, l.Renew)
+				l.logger.Info("Lock acquired", "ownerID", l.ownerID, "token", l.token)
+				return l.token, nil
+			}
+			l.holds++
+			l.logger.Info("Lock is already held by the current owner", "ownerID", l.ownerID, "holds", l.holds)
+			return l.token, nil
+		}
+
+		currentOwnerID := lock.ownerID
+		l.registry.mu.Unlock()
+		l.logger.Warn("Lock is already held by another owner", "currentOwnerID", currentOwnerID)
+		return 0, fmt.Errorf("%w by %s", ErrLockHeld, currentOwnerID)
+	}
+
+	lock.ownerID = l.ownerID
+	lock.expiredAt = now.Add(l.lockTimeout)
+	lock.token++
+	token := lock.token
+	l.registry.mu.Unlock()
+
+	l.token = token
+	l.holds = 1
+	l.keeper.start(ctx, l.Renew)
+
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "token", token)
+	return token, nil
+}
+
+// Unlock releases the lock.
+func (l *MemoryLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockName, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *MemoryLocker) unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.holds > 1 {
+		l.holds--
+		l.logger.Info("Lock is still held by the current owner", "ownerID", l.ownerID, "holds", l.holds)
+		return nil
+	}
+	l.holds = 0
+	l.token = 0
+
+	if l.keeper.stop() {
+		l.logger.Info("Stopped renewing lock", "lockName", l.lockName)
+	}
+
+	l.registry.mu.Lock()
+	defer l.registry.mu.Unlock()
+
+	lock := l.registry.lock(l.lockName)
+	if err := l.ownershipError(lock); err != nil {
+		l.logger.Warn("Lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
+		return err
+	}
+
+	lock.ownerID = ""
+	lock.expiredAt = l.clock.Now()
+	close(lock.released)
+	lock.released = make(chan struct{})
+
+	l.logger.Info("Lock released", "ownerID", l.ownerID)
+	return nil
+}
+
+// Renew refreshes the lock's expiration time.
+func (l *MemoryLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockName, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *MemoryLocker) renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.registry.mu.Lock()
+	defer l.registry.mu.Unlock()
+
+	lock := l.registry.lock(l.lockName)
+	if err := l.ownershipError(lock); err != nil {
+		l.logger.Warn("Lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
+		return err
+	}
+
+	lock.expiredAt = l.clock.Now().Add(l.lockTimeout)
+
+	l.logger.Info("Lock renewed", "ownerID", l.ownerID)
+	return nil
+}
+
+// NotifyRelease implements ReleaseNotifier. Only explicit releases are
+// notified, since expiry is only detected by the next attempt to take the lock.
+func (l *MemoryLocker) NotifyRelease(ctx context.Context) (<-chan struct{}, error) {
+	l.registry.mu.Lock()
+	releasedCh := l.registry.lock(l.lockName).released
+	l.registry.mu.Unlock()
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		select {
+		case <-ctx.Done():
+		case <-releasedCh:
+		}
+	}()
+
+	return released, nil
+}
+
+// Holder implements HolderInspector.
+func (l *MemoryLocker) Holder(ctx context.Context) (string, int64, error) {
+	l.registry.mu.Lock()
+	defer l.registry.mu.Unlock()
+
+	lock := l.registry.lock(l.lockName)
+	if !l.held(lock, l.clock.Now()) {
+		return "", 0, nil
+	}
+	return lock.ownerID, lock.token, nil
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *MemoryLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
+}
+
+// held reports whether the lock is held by anybody at the given time.
+func (l *MemoryLocker) held(lock *memoryLock, now time.Time) bool {
+	return lock.ownerID != "" && now.Before(lock.expiredAt)
+}
+
+// ownershipError tells whether the lock is still held by the current owner.
+func (l *MemoryLocker) ownershipError(lock *memoryLock) error {
+	if !l.held(lock, l.clock.Now()) {
+		return ErrLockLost
+	}
+	if lock.ownerID != l.ownerID {
+		return ErrNotOwner
+	}
+	return nil
+}
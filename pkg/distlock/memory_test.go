@@ -0,0 +1,120 @@
+package distlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/distlock/distlocktest"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	registry := distlock.NewMemoryRegistry()
+	clock := clocktesting.NewFakeClock(time.Now())
+
+	distlocktest.Run(t, distlocktest.Backend{
+		NewLocker: func(t *testing.T, opts ...distlock.Option) distlock.Locker {
+			// All lockers share the fake clock, which overrides the one set by the suite
+			return distlock.NewMemoryLocker(registry, append(opts, distlock.WithClock(clock))...)
+		},
+		Advance: func(t *testing.T, d time.Duration) {
+			clock.Step(d)
+		},
+		Reentrant: true,
+	})
+}
+
+func newMemoryLockers(clock *clocktesting.FakeClock, owners ...string) []*distlock.MemoryLocker {
+	registry := distlock.NewMemoryRegistry()
+
+	lockers := make([]*distlock.MemoryLocker, 0, len(owners))
+	for _, owner := range owners {
+		lockers = append(lockers, distlock.NewMemoryLocker(registry,
+			distlock.WithOwnerID(owner),
+			distlock.WithLockTimeout(10*time.Second),
+			distlock.WithClock(clock),
+		))
+	}
+	return lockers
+}
+
+func TestMemoryLocker_MutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	lockers := newMemoryLockers(clocktesting.NewFakeClock(time.Now()), "a", "b")
+	a, b := lockers[0], lockers[1]
+
+	token1, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	// 锁被 a 持有时，b 无法获取锁，也无法释放或续约
+	_, err = b.Lock(ctx)
+	assert.ErrorIs(t, err, distlock.ErrLockHeld)
+	assert.ErrorIs(t, b.Unlock(ctx), distlock.ErrNotOwner)
+	assert.ErrorIs(t, b.Renew(ctx), distlock.ErrNotOwner)
+
+	owner, token, err := b.Holder(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", owner)
+	assert.Equal(t, token1, token)
+
+	// a 释放后，b 可以获取锁，并且拿到更大的 token
+	require.NoError(t, a.Unlock(ctx))
+	token2, err := b.Lock(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, token2, token1)
+	require.NoError(t, b.Unlock(ctx))
+
+	owner, _, err = a.Holder(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, owner)
+}
+
+func TestMemoryLocker_Expiry(t *testing.T) {
+	ctx := context.Background()
+	clock := clocktesting.NewFakeClock(time.Now())
+	lockers := newMemoryLockers(clock, "a", "b")
+	a, b := lockers[0], lockers[1]
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+	lost := a.Lost()
+
+	// 时间越过租约后，a 的锁过期，b 可以接管
+	clock.Step(11 * time.Second)
+	_, err = b.Lock(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease loss was not reported")
+	}
+
+	assert.ErrorIs(t, a.Renew(ctx), distlock.ErrNotOwner)
+	assert.ErrorIs(t, a.Unlock(ctx), distlock.ErrNotOwner)
+	assert.NoError(t, b.Unlock(ctx))
+}
+
+func TestMemoryLocker_NotifyRelease(t *testing.T) {
+	ctx := context.Background()
+	lockers := newMemoryLockers(clocktesting.NewFakeClock(time.Now()), "a", "b")
+	a, b := lockers[0], lockers[1]
+
+	_, err := a.Lock(ctx)
+	require.NoError(t, err)
+
+	released, err := b.NotifyRelease(ctx)
+	require.NoError(t, err)
+	require.NoError(t, a.Unlock(ctx))
+
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("release was not notified")
+	}
+}
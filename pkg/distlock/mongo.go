@@ -15,20 +15,23 @@ import (
 
 // MongoLocker provides a distributed locking mechanism using MongoDB.
 type MongoLocker struct {
-	client         *mongo.Client
-	lockCollection *mongo.Collection
-	lockName       string
-	lockTimeout    time.Duration
-	renewTicker    *time.Ticker
-	stopChan       chan struct{}
-	mu             sync.Mutex
-	ownerID        string
-	logger         logger.Logger
+	client          *mongo.Client
+	lockCollection  *mongo.Collection
+	lockName        string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string
+	logger          logger.Logger
 }
 
 // Ensure MongoLocker implements the Locker interface.
 var _ Locker = (*MongoLocker)(nil)
 
+// Ensure MongoLocker implements the HolderInspector interface.
+var _ HolderInspector = (*MongoLocker)(nil)
+
 // NewMongoLocker creates a new MongoLocker instance.
 func NewMongoLocker(mongoURI string, dbName string, opts ...Option) (*MongoLocker, error) {
 	o := ApplyOptions(opts...)
@@ -37,14 +40,26 @@ func NewMongoLocker(mongoURI string, dbName string, opts ...Option) (*MongoLocke
 		return nil, err
 	}
 
+	// The unique index makes concurrent upserts of the same lock fail instead of
+	// creating two lock documents.
+	lockCollection := client.Database(dbName).Collection("locks")
+	_, err = lockCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	locker := &MongoLocker{
-		client:         client,
-		lockCollection: client.Database(dbName).Collection("locks"),
-		lockName:       o.lockName,
-		lockTimeout:    o.lockTimeout,
-		stopChan:       make(chan struct{}),
-		ownerID:        o.ownerID,
-		logger:         o.logger,
+		client:          client,
+		lockCollection:  lockCollection,
+		lockName:        o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
 	}
 
 	locker.logger.Info("MongoLocker initialized", "lockName", locker.lockName, "ownerID", locker.ownerID)
@@ -52,94 +67,153 @@ func NewMongoLocker(mongoURI string, dbName string, opts ...Option) (*MongoLocke
 }
 
 // Lock attempts to acquire the distributed lock.
-func (l *MongoLocker) Lock(ctx context.Context) error {
+// The fencing token is a counter kept in the lock document, which is never
+// deleted so that the counter keeps growing across acquisitions.
+func (l *MongoLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockName, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *MongoLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	now := time.Now()
 	expiredAt := now.Add(l.lockTimeout)
 
-	filter := bson.M{"name": l.lockName}
-	update := bson.M{
-		"$setOnInsert": bson.M{
-			"ownerID":   l.ownerID,
-			"expiredAt": expiredAt,
+	// Match the lock only if it is free (expired) or already owned by us.
+	// Otherwise the upsert conflicts with the unique index on name.
+	filter := bson.M{
+		"name": l.lockName,
+		"$or": bson.A{
+			bson.M{"ownerID": l.ownerID},
+			bson.M{"expiredAt": bson.M{"$lt": now}},
 		},
+	}
+	update := bson.M{
 		"$set": bson.M{
 			"ownerID":   l.ownerID,
 			"expiredAt": expiredAt,
 		},
+		"$inc": bson.M{"token": int64(1)},
 	}
 
-	opts := options.Update().SetUpsert(true)
-	result, err := l.lockCollection.UpdateOne(ctx, filter, update, opts)
-	if err != nil {
-		l.logger.Error("Failed to acquire lock", "error", err)
-		return fmt.Errorf("failed to acquire lock: %v", err)
+	var lock struct {
+		Token int64 `bson:"token"`
 	}
-
-	if result.MatchedCount == 0 {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := l.lockCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&lock)
+	if mongo.IsDuplicateKeyError(err) {
 		l.logger.Warn("Lock is already held by another owner", "lockName", l.lockName)
-		return fmt.Errorf("lock is already held by another owner")
+		return 0, fmt.Errorf("%w by another owner", ErrLockHeld)
+	}
+	if err != nil {
+		l.logger.Error("Failed to acquire lock", "error", err)
+		return 0, fmt.Errorf("failed to acquire lock: %v", err)
 	}
 
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx)
+	l.keeper.start(ctx, l.Renew)
 
-	l.logger.Info("Lock acquired", "ownerID", l.ownerID)
-	return nil
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "token", lock.Token)
+	return lock.Token, nil
 }
 
 // Unlock releases the distributed lock.
 func (l *MongoLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockName, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *MongoLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
+	if l.keeper.stop() {
 		l.logger.Info("Stopped renewing lock", "lockName", l.lockName)
 	}
 
-	_, err := l.lockCollection.DeleteOne(ctx, bson.M{"name": l.lockName})
+	filter := bson.M{"name": l.lockName, "ownerID": l.ownerID}
+	update := bson.M{"$set": bson.M{"ownerID": "", "expiredAt": time.Now()}}
+	result, err := l.lockCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		l.logger.Error("Failed to release lock", "error", err)
 		return fmt.Errorf("failed to release lock: %v", err)
 	}
+	if result.MatchedCount == 0 {
+		err := l.ownershipError(ctx)
+		l.logger.Warn("Lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
+		return err
+	}
 
 	l.logger.Info("Lock released", "ownerID", l.ownerID)
-	l.ownerID = ""
 	return nil
 }
 
 // Renew refreshes the lock's expiration time.
 func (l *MongoLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockName, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *MongoLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	now := time.Now()
 	expiredAt := now.Add(l.lockTimeout)
 
-	_, err := l.lockCollection.UpdateOne(ctx, bson.M{"name": l.lockName}, bson.M{"$set": bson.M{"expiredAt": expiredAt}})
+	filter := bson.M{"name": l.lockName, "ownerID": l.ownerID}
+	result, err := l.lockCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"expiredAt": expiredAt}})
 	if err != nil {
 		l.logger.Error("Failed to renew lock", "error", err)
 		return fmt.Errorf("failed to renew lock: %v", err)
 	}
+	if result.MatchedCount == 0 {
+		err := l.ownershipError(ctx)
+		l.logger.Warn("Lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
+		return err
+	}
 
 	l.logger.Info("Lock renewed", "ownerID", l.ownerID)
 	return nil
 }
 
-// renewLock periodically renews the lock.
-func (l *MongoLocker) renewLock(ctx context.Context) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("Failed to renew lock", "error", err)
-			}
-		}
+// Holder implements HolderInspector by reading the lock document.
+func (l *MongoLocker) Holder(ctx context.Context) (string, int64, error) {
+	var lock struct {
+		OwnerID   string    `bson:"ownerID"`
+		ExpiredAt time.Time `bson:"expiredAt"`
+		Token     int64     `bson:"token"`
 	}
+	err := l.lockCollection.FindOne(ctx, bson.M{"name": l.lockName}).Decode(&lock)
+	if err == mongo.ErrNoDocuments {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if lock.OwnerID == "" || lock.ExpiredAt.Before(time.Now()) {
+		return "", 0, nil
+	}
+
+	return lock.OwnerID, lock.Token, nil
+}
+
+// ownershipError tells why a conditional update of the lock document matched
+// nothing: either another owner holds the lock, or the lock has been released.
+func (l *MongoLocker) ownershipError(ctx context.Context) error {
+	var lock struct {
+		OwnerID string `bson:"ownerID"`
+	}
+	err := l.lockCollection.FindOne(ctx, bson.M{"name": l.lockName}).Decode(&lock)
+	if err == nil && lock.OwnerID != "" && lock.OwnerID != l.ownerID {
+		return ErrNotOwner
+	}
+	return ErrLockLost
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *MongoLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
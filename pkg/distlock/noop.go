@@ -10,12 +10,14 @@ import (
 
 // NoopLocker provides a no-operation implementation of a distributed lock.
 type NoopLocker struct {
-	lockTimeout time.Duration
-	renewTicker *time.Ticker
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	ownerID     string // Records the owner ID
-	logger      logger.Logger
+	lockName        string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string // Records the owner ID
+	token           int64  // Records the last fencing token handed out
+	logger          logger.Logger
 }
 
 // Ensure NoopLocker implements the Locker interface.
@@ -25,36 +27,46 @@ var _ Locker = (*NoopLocker)(nil)
 func NewNoopLocker(opts ...Option) *NoopLocker {
 	o := ApplyOptions(opts...)
 	return &NoopLocker{
-		lockTimeout: o.lockTimeout,
-		ownerID:     o.ownerID,
-		stopChan:    make(chan struct{}),
-		logger:      o.logger, // Initialize logger
+		lockName:        o.lockName,
+		lockTimeout:     o.lockTimeout,
+		ownerID:         o.ownerID,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		logger:          o.logger, // Initialize logger
 	}
 }
 
 // Lock simulates acquiring a distributed lock.
-func (l *NoopLocker) Lock(ctx context.Context) error {
+// The fencing token is a local counter.
+func (l *NoopLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockName, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *NoopLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Start the renewal goroutine
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx)
+	l.keeper.start(ctx, l.Renew)
 
-	l.logger.Info("Lock acquired", "ownerID", l.ownerID)
-	return nil
+	l.token++
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "token", l.token)
+	return l.token, nil
 }
 
 // Unlock simulates releasing a distributed lock.
 func (l *NoopLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockName, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *NoopLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Stop the renewal process
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
-	}
+	l.keeper.stop()
 
 	l.logger.Info("Lock released", "ownerID", l.ownerID)
 	l.ownerID = "" // Clear the owner ID
@@ -63,6 +75,11 @@ func (l *NoopLocker) Unlock(ctx context.Context) error {
 
 // Renew simulates refreshing the lock's expiration time.
 func (l *NoopLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockName, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *NoopLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -71,16 +88,7 @@ func (l *NoopLocker) Renew(ctx context.Context) error {
 	return nil
 }
 
-// renewLock periodically renews the lock.
-func (l *NoopLocker) renewLock(ctx context.Context) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("Failed to renew lock", "error", err)
-			}
-		}
-	}
+// Lost returns a channel which is never closed, since renewals always succeed.
+func (l *NoopLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
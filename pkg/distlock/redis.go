@@ -12,30 +12,140 @@ import (
 )
 
 // RedisLocker provides a distributed locking mechanism using Redis.
+// It is reentrant: Lock and RLock may be called again while the lock is held,
+// and the lock is only released after the matching number of Unlock or RUnlock
+// calls. Hold counts are kept by the RedisLocker instance.
 type RedisLocker struct {
-	client      *redis.Client
-	lockName    string
-	lockTimeout time.Duration
-	renewTicker *time.Ticker
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	ownerID     string
-	logger      logger.Logger
+	client          *redis.Client
+	lockName        string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string
+	token           int64 // Fencing token of the write lock while it is held
+	holds           int   // Number of times the write lock is held
+	readHolds       int   // Number of times the read lock is held
+	logger          logger.Logger
 }
 
+// acquireScript sets the lock key if it is absent and there are no live
+// readers, and increments the fencing counter of the lock. ARGV[3] is the token
+// held by the caller, if any. The script returns the new fencing token, ARGV[3]
+// when the caller still holds the lock, whose expiration time is then reset,
+// 0 when the lock is held by another owner, or -1 when it is held by readers.
+var acquireScript = redis.NewScript(`
+if ARGV[3] ~= "0" and redis.call("GET", KEYS[1]) == ARGV[1] and redis.call("GET", KEYS[2]) == ARGV[3] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return tonumber(ARGV[3])
+end
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[3], "-inf", now)
+if redis.call("ZCARD", KEYS[3]) > 0 then
+	return -1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// readAcquireScript adds the caller to the readers of the lock, a sorted set
+// scored by the expiration time of every reader, unless the write lock is held
+// by another owner. The readers key expires together with its last reader.
+// It returns 2 if the caller was already a live reader, 1 if it was added and
+// 0 if the write lock is held by another owner.
+var readAcquireScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local score = redis.call("ZSCORE", KEYS[2], ARGV[1])
+redis.call("ZADD", KEYS[2], now + tonumber(ARGV[2]), ARGV[1])
+local last = redis.call("ZRANGE", KEYS[2], -1, -1, "WITHSCORES")
+redis.call("PEXPIREAT", KEYS[2], last[2])
+if score and tonumber(score) > now then
+	return 2
+end
+return 1
+`)
+
+// readReleaseScript removes the caller from the readers of the lock.
+// It returns 1 on success and 0 if the caller is not a reader.
+var readReleaseScript = redis.NewScript(`
+return redis.call("ZREM", KEYS[1], ARGV[1])
+`)
+
+// readRenewScript extends the read lock of the caller if it has not expired.
+// It returns 1 on success and 0 if the caller is not a live reader.
+var readRenewScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not score or tonumber(score) <= now then
+	return 0
+end
+redis.call("ZADD", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+redis.call("PEXPIREAT", KEYS[1], last[2])
+return 1
+`)
+
+// releaseScript deletes the lock key only if it still belongs to the caller.
+// It returns 1 on success, 0 if the key does not exist and -1 if it is held by
+// another owner.
+var releaseScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if not owner then
+	return 0
+end
+if owner ~= ARGV[1] then
+	return -1
+end
+redis.call("DEL", KEYS[1])
+return 1
+`)
+
+// renewScript extends the lock key only if it still belongs to the caller.
+// It returns the same values as releaseScript.
+var renewScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if not owner then
+	return 0
+end
+if owner ~= ARGV[1] then
+	return -1
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return 1
+`)
+
 // Ensure RedisLocker implements the Locker interface.
 var _ Locker = (*RedisLocker)(nil)
 
+// Ensure RedisLocker implements the RWLocker interface.
+var _ RWLocker = (*RedisLocker)(nil)
+
+// Ensure RedisLocker implements the ReleaseNotifier interface.
+var _ ReleaseNotifier = (*RedisLocker)(nil)
+
+// Ensure RedisLocker implements the HolderInspector interface.
+var _ HolderInspector = (*RedisLocker)(nil)
+
 // NewRedisLocker creates a new RedisLocker instance.
 func NewRedisLocker(client *redis.Client, opts ...Option) *RedisLocker {
 	o := ApplyOptions(opts...)
 	locker := &RedisLocker{
-		client:      client,
-		lockName:    o.lockName,
-		lockTimeout: o.lockTimeout,
-		stopChan:    make(chan struct{}),
-		ownerID:     o.ownerID,
-		logger:      o.logger,
+		client:          client,
+		lockName:        o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
 	}
 
 	locker.logger.Info("RedisLocker initialized", "lockName", locker.lockName, "ownerID", locker.ownerID)
@@ -43,52 +153,87 @@ func NewRedisLocker(client *redis.Client, opts ...Option) *RedisLocker {
 }
 
 // Lock attempts to acquire the distributed lock.
-func (l *RedisLocker) Lock(ctx context.Context) error {
+// The fencing token is taken from a counter stored next to the lock key.
+func (l *RedisLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockName, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *RedisLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	success, err := l.client.SetNX(ctx, l.lockName, l.ownerID, l.lockTimeout).Result()
+	var heldToken int64
+	if l.holds > 0 {
+		heldToken = l.token
+	}
+
+	keys := []string{l.lockName, l.fencingKey(), l.readersKey()}
+	token, err := acquireScript.Run(ctx, l.client, keys, l.ownerID, l.lockTimeout.Milliseconds(), heldToken).Int64()
 	if err != nil {
 		l.logger.Error("Failed to set lock", "error", err)
-		return err
+		return 0, err
+	}
+	if token == -1 {
+		l.logger.Warn("Lock is already held by readers", "lockName", l.lockName)
+		return 0, fmt.Errorf("%w by readers", ErrLockHeld)
 	}
-	if !success {
+	if token == 0 {
 		currentOwnerID, err := l.client.Get(ctx, l.lockName).Result()
-		if err != nil {
+		if err != nil && err != redis.Nil {
 			l.logger.Error("Failed to get current owner ID", "error", err)
-			return err
-		}
-		if currentOwnerID != l.ownerID {
-			l.logger.Warn("Lock is already held by another owner", "currentOwnerID", currentOwnerID)
-			return fmt.Errorf("lock is already held by %s", currentOwnerID)
+			return 0, err
 		}
-		l.logger.Info("Lock is already held by the current owner, extending the lock if needed")
-		return nil
+		l.logger.Warn("Lock is already held by another owner", "currentOwnerID", currentOwnerID)
+		return 0, fmt.Errorf("%w by %s", ErrLockHeld, currentOwnerID)
+	}
+	// A lease which has been declared lost is started over, since the lock
+	// still belongs to the caller but is no longer renewed.
+	if heldToken != 0 && token == heldToken && l.keeper.running() {
+		l.holds++
+		l.logger.Info("Lock is already held by the current owner", "ownerID", l.ownerID, "holds", l.holds)
+		return token, nil
 	}
 
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx)
+	l.token = token
+	l.holds = 1
+	l.keeper.start(ctx, l.Renew)
 
-	l.logger.Info("Lock acquired", "ownerID", l.ownerID)
-	return nil
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "token", token)
+	return token, nil
 }
 
 // Unlock releases the distributed lock.
 func (l *RedisLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockName, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *RedisLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
+	if l.holds > 1 {
+		l.holds--
+		l.logger.Info("Lock is still held by the current owner", "ownerID", l.ownerID, "holds", l.holds)
+		return nil
+	}
+	l.holds = 0
+	l.token = 0
+
+	if l.readHolds == 0 && l.keeper.stop() {
 		l.logger.Info("Stopped renewing lock", "lockName", l.lockName)
 	}
 
-	err := l.client.Del(ctx, l.lockName).Err()
+	result, err := releaseScript.Run(ctx, l.client, []string{l.lockName}, l.ownerID).Int64()
 	if err != nil {
 		l.logger.Error("Failed to delete lock", "error", err)
 		return err
 	}
+	if err := ownershipError(result); err != nil {
+		l.logger.Warn("Lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
+		return err
+	}
 
 	l.logger.Info("Lock released", "ownerID", l.ownerID)
 	return nil
@@ -96,29 +241,183 @@ func (l *RedisLocker) Unlock(ctx context.Context) error {
 
 // Renew refreshes the lock's expiration time.
 func (l *RedisLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockName, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *RedisLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	err := l.client.Expire(ctx, l.lockName, l.lockTimeout).Err()
+	if l.readHolds > 0 {
+		result, err := readRenewScript.Run(ctx, l.client, []string{l.readersKey()}, l.ownerID, l.lockTimeout.Milliseconds()).Int64()
+		if err != nil {
+			l.logger.Error("Failed to renew read lock", "error", err)
+			return err
+		}
+		if result == 0 {
+			l.logger.Warn("Read lock is no longer held by the current owner", "lockName", l.lockName)
+			return ErrLockLost
+		}
+		if l.holds == 0 {
+			l.logger.Info("Read lock renewed", "ownerID", l.ownerID)
+			return nil
+		}
+	}
+
+	keys := []string{l.lockName}
+	result, err := renewScript.Run(ctx, l.client, keys, l.ownerID, l.lockTimeout.Milliseconds()).Int64()
 	if err != nil {
 		l.logger.Error("Failed to renew lock", "error", err)
 		return err
 	}
+	if err := ownershipError(result); err != nil {
+		l.logger.Warn("Lock is no longer held by the current owner", "lockName", l.lockName, "error", err)
+		return err
+	}
 
 	l.logger.Info("Lock renewed", "ownerID", l.ownerID)
 	return nil
 }
 
-// renewLock periodically renews the lock.
-func (l *RedisLocker) renewLock(ctx context.Context) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("Failed to renew lock", "error", err)
+// RLock attempts to acquire the read lock.
+func (l *RedisLocker) RLock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := []string{l.lockName, l.readersKey()}
+	result, err := readAcquireScript.Run(ctx, l.client, keys, l.ownerID, l.lockTimeout.Milliseconds()).Int64()
+	if err != nil {
+		l.logger.Error("Failed to acquire read lock", "error", err)
+		return err
+	}
+	if result == 0 {
+		l.logger.Warn("Lock is already held by a writer", "lockName", l.lockName)
+		return fmt.Errorf("%w by a writer", ErrLockHeld)
+	}
+	if result == 2 && l.readHolds > 0 {
+		l.readHolds++
+		l.logger.Info("Read lock is already held by the current owner", "ownerID", l.ownerID, "readHolds", l.readHolds)
+		return nil
+	}
+
+	l.readHolds = 1
+	if l.holds == 0 {
+		l.keeper.start(ctx, l.Renew)
+	}
+
+	l.logger.Info("Read lock acquired", "ownerID", l.ownerID)
+	return nil
+}
+
+// RUnlock releases the read lock.
+func (l *RedisLocker) RUnlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.readHolds > 1 {
+		l.readHolds--
+		l.logger.Info("Read lock is still held by the current owner", "ownerID", l.ownerID, "readHolds", l.readHolds)
+		return nil
+	}
+	l.readHolds = 0
+
+	if l.holds == 0 && l.keeper.stop() {
+		l.logger.Info("Stopped renewing lock", "lockName", l.lockName)
+	}
+
+	result, err := readReleaseScript.Run(ctx, l.client, []string{l.readersKey()}, l.ownerID).Int64()
+	if err != nil {
+		l.logger.Error("Failed to release read lock", "error", err)
+		return err
+	}
+	if result == 0 {
+		l.logger.Warn("Read lock is no longer held by the current owner", "lockName", l.lockName)
+		return ErrLockLost
+	}
+
+	l.logger.Info("Read lock released", "ownerID", l.ownerID)
+	return nil
+}
+
+// NotifyRelease implements ReleaseNotifier using Redis keyspace notifications.
+// The server must publish generic and expired events for this to work, e.g.
+// with `notify-keyspace-events Kgx`. Otherwise the returned channel is only
+// closed when ctx is done.
+func (l *RedisLocker) NotifyRelease(ctx context.Context) (<-chan struct{}, error) {
+	channel := fmt.Sprintf("__keyspace@%d__:%s", l.client.Options().DB, l.lockName)
+	pubsub := l.client.Subscribe(ctx, channel)
+	// Wait for the subscription to be confirmed, so that no event is missed.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok || msg.Payload == "del" || msg.Payload == "expired" {
+					return
+				}
 			}
 		}
+	}()
+
+	return released, nil
+}
+
+// Holder implements HolderInspector. Both the owner and the fencing counter
+// are read in one transaction, so the token is the one of the current holder.
+func (l *RedisLocker) Holder(ctx context.Context) (string, int64, error) {
+	var owner, token *redis.StringCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		owner = pipe.Get(ctx, l.lockName)
+		token = pipe.Get(ctx, l.fencingKey())
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return "", 0, err
+	}
+	if owner.Err() == redis.Nil {
+		return "", 0, nil
 	}
+
+	currentToken, _ := token.Int64()
+	return owner.Val(), currentToken, nil
+}
+
+// fencingKey returns the key of the fencing counter for the lock.
+func (l *RedisLocker) fencingKey() string {
+	return l.lockName + ":fencing"
+}
+
+// readersKey returns the key of the sorted set of readers of the lock.
+func (l *RedisLocker) readersKey() string {
+	return l.lockName + ":readers"
+}
+
+// ownershipError converts the result of releaseScript and renewScript to an error.
+func ownershipError(result int64) error {
+	switch result {
+	case 0:
+		return ErrLockLost
+	case -1:
+		return ErrNotOwner
+	default:
+		return nil
+	}
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *RedisLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
@@ -0,0 +1,36 @@
+package distlock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/distlock/distlocktest"
+)
+
+func TestRedisLocker(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	distlocktest.Run(t, distlocktest.Backend{
+		NewLocker: func(t *testing.T, opts ...distlock.Option) distlock.Locker {
+			return distlock.NewRedisLocker(client, opts...)
+		},
+		// miniredis only expires keys when told to
+		Advance: func(t *testing.T, d time.Duration) {
+			server.FastForward(d)
+		},
+		NewSemaphore: func(t *testing.T, opts ...distlock.Option) distlock.Semaphore {
+			return distlock.NewRedisSemaphore(client, opts...)
+		},
+		Reentrant: true,
+		Interrupt: func(t *testing.T) func() {
+			server.SetError("ERR unavailable")
+			return func() { server.SetError("") }
+		},
+	})
+}
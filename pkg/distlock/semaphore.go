@@ -0,0 +1,68 @@
+package distlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// ErrNoPermits is returned by TryAcquire when not enough permits are available.
+var ErrNoPermits = errors.New("not enough permits available")
+
+// Semaphore is a counting semaphore shared by all instances using the same
+// name. It admits at most as many permits at the same time as its capacity,
+// which is set with WithCapacity. Acquired permits are leases: they are renewed
+// in the background while held and expire if their holder goes away.
+type Semaphore interface {
+	// Acquire blocks until n permits are acquired or ctx is done.
+	Acquire(ctx context.Context, n int64) error
+
+	// TryAcquire attempts to acquire n permits without blocking. It returns an
+	// error wrapping ErrNoPermits if not enough permits are available.
+	TryAcquire(ctx context.Context, n int64) error
+
+	// Release releases n of the permits held by the caller.
+	Release(ctx context.Context, n int64) error
+
+	// Renew extends the leases of all permits held by the caller.
+	Renew(ctx context.Context) error
+
+	// Lost returns a channel which is closed when the permits, once acquired,
+	// are lost because they could not be renewed in time.
+	Lost() <-chan struct{}
+}
+
+// acquirePermits calls tryAcquire until it succeeds or ctx is done, waiting
+// according to backoff between two attempts. Errors of individual attempts are
+// logged and retried.
+func acquirePermits(ctx context.Context, backoff wait.Backoff, clock clock.Clock, logger logger.Logger, tryAcquire func(ctx context.Context) error) error {
+	for {
+		err := tryAcquire(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.Debug("Failed to acquire permits, waiting", "error", err)
+
+		timer := clock.NewTimer(backoff.Step())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("failed to acquire permits: %w", ctx.Err())
+		case <-timer.C():
+		}
+	}
+}
+
+// validatePermits checks that n permits can ever be acquired from a semaphore
+// with the given capacity.
+func validatePermits(n, capacity int64) error {
+	if n <= 0 || n > capacity {
+		return fmt.Errorf("invalid number of permits %d, must be between 1 and %d", n, capacity)
+	}
+	return nil
+}
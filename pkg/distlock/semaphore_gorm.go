@@ -0,0 +1,241 @@
+package distlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// GORMSemaphore implements Semaphore using GORM. Every permit is a row of the
+// semaphore_slots table, and a semaphore has one row per unit of capacity.
+type GORMSemaphore struct {
+	db          *gorm.DB
+	name        string
+	capacity    int64
+	lockTimeout time.Duration
+	backoff     wait.Backoff
+	clock       clock.WithTicker
+	keeper      *leaseKeeper
+	mu          sync.Mutex
+	ownerID     string
+	holderID    string  // Identifies this instance in the slots it holds
+	slots       []int64 // Slots held by this instance
+	logger      logger.Logger
+}
+
+// SemaphoreSlot represents a database record for a slot of a semaphore.
+// A slot is free when it has no owner or its lease has expired.
+type SemaphoreSlot struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"size:255;uniqueIndex:idx_semaphore_slot"`
+	Slot      int64  `gorm:"uniqueIndex:idx_semaphore_slot"`
+	OwnerID   string
+	ExpiredAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Ensure GORMSemaphore implements the Semaphore interface.
+var _ Semaphore = (*GORMSemaphore)(nil)
+
+// NewGORMSemaphore initializes a new GORMSemaphore instance.
+// The lock name is used as the name of the semaphore.
+func NewGORMSemaphore(db *gorm.DB, opts ...Option) (*GORMSemaphore, error) {
+	o := ApplyOptions(opts...)
+
+	if err := db.AutoMigrate(&SemaphoreSlot{}); err != nil {
+		return nil, err
+	}
+
+	semaphore := &GORMSemaphore{
+		db:          db,
+		name:        o.lockName,
+		capacity:    o.capacity,
+		lockTimeout: o.lockTimeout,
+		backoff:     o.backoff,
+		clock:       o.clock,
+		keeper:      newLeaseKeeper(o),
+		ownerID:     o.ownerID,
+		holderID:    o.ownerID + ":" + uuid.NewString(),
+		logger:      o.logger,
+	}
+
+	semaphore.logger.Info("GORMSemaphore initialized", "name", semaphore.name, "capacity", semaphore.capacity, "ownerID", semaphore.ownerID)
+
+	return semaphore, nil
+}
+
+// Acquire blocks until n permits are acquired or ctx is done.
+func (s *GORMSemaphore) Acquire(ctx context.Context, n int64) error {
+	if err := validatePermits(n, s.capacity); err != nil {
+		return err
+	}
+
+	return acquirePermits(ctx, s.backoff, s.clock, s.logger, func(ctx context.Context) error {
+		return s.TryAcquire(ctx, n)
+	})
+}
+
+// TryAcquire attempts to acquire n permits without blocking.
+// The free slots are locked with SELECT ... FOR UPDATE and taken over within
+// the same transaction.
+func (s *GORMSemaphore) TryAcquire(ctx context.Context, n int64) error {
+	if err := validatePermits(n, s.capacity); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.createSlots(ctx); err != nil {
+		s.logger.Error("failed to create semaphore slots", "error", err)
+		return err
+	}
+
+	now := time.Now()
+	expiredAt := now.Add(s.lockTimeout)
+
+	var slots []int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var free []SemaphoreSlot
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("name = ? AND slot < ? AND (owner_id = ? OR expired_at < ?)", s.name, s.capacity, "", now).
+			Order("slot").
+			Limit(int(n)).
+			Find(&free).Error
+		if err != nil {
+			return err
+		}
+		if int64(len(free)) < n {
+			return fmt.Errorf("%w for %d permits", ErrNoPermits, n)
+		}
+
+		for _, slot := range free {
+			slots = append(slots, slot.Slot)
+		}
+		result := tx.Model(&SemaphoreSlot{}).
+			Where("name = ? AND slot IN ? AND (owner_id = ? OR expired_at < ?)", s.name, slots, "", now).
+			Updates(map[string]any{"owner_id": s.holderID, "expired_at": expiredAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < n {
+			// Some of the slots have been taken in the meantime
+			return fmt.Errorf("%w for %d permits", ErrNoPermits, n)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNoPermits) {
+		s.logger.Debug("not enough permits available", "name", s.name, "permits", n)
+		return err
+	}
+	if err != nil {
+		s.logger.Error("failed to acquire permits", "error", err)
+		return err
+	}
+
+	if !s.keeper.running() {
+		s.keeper.start(ctx, s.Renew)
+	}
+	s.slots = append(s.slots, slots...)
+
+	s.logger.Info("Permits acquired", "name", s.name, "permits", n, "held", len(s.slots))
+	return nil
+}
+
+// Release releases n of the permits held by this instance.
+func (s *GORMSemaphore) Release(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 || n > int64(len(s.slots)) {
+		return fmt.Errorf("cannot release %d permits, %d are held", n, len(s.slots))
+	}
+
+	released := s.slots[int64(len(s.slots))-n:]
+	s.slots = s.slots[:int64(len(s.slots))-n]
+	if len(s.slots) == 0 && s.keeper.stop() {
+		s.logger.Info("Stopped renewing permits", "name", s.name)
+	}
+
+	result := s.db.WithContext(ctx).Model(&SemaphoreSlot{}).
+		Where("name = ? AND slot IN ? AND owner_id = ?", s.name, released, s.holderID).
+		Updates(map[string]any{"owner_id": "", "expired_at": time.Now()})
+	if result.Error != nil {
+		s.logger.Error("failed to release permits", "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected < n {
+		s.logger.Warn("some permits have been taken over before being released", "name", s.name, "permits", n, "released", result.RowsAffected)
+		return ErrLockLost
+	}
+
+	s.logger.Info("Permits released", "name", s.name, "permits", n, "held", len(s.slots))
+	return nil
+}
+
+// Renew extends the leases of all permits held by this instance.
+func (s *GORMSemaphore) Renew(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.slots) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	expiredAt := now.Add(s.lockTimeout)
+
+	result := s.db.WithContext(ctx).Model(&SemaphoreSlot{}).
+		Where("name = ? AND slot IN ? AND owner_id = ? AND expired_at >= ?", s.name, s.slots, s.holderID, now).
+		Update("expired_at", expiredAt)
+	if result.Error != nil {
+		s.logger.Error("failed to renew permits", "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected < int64(len(s.slots)) {
+		// Forget the permits, so that acquiring new ones starts a new lease
+		s.logger.Warn("permits have expired", "name", s.name)
+		s.slots = nil
+		return ErrLockLost
+	}
+
+	s.logger.Info("Permits renewed", "name", s.name, "held", len(s.slots), "newExpiration", expiredAt)
+	return nil
+}
+
+// Lost returns a channel which is closed when the permits, once acquired, are
+// lost because they could not be renewed in time.
+func (s *GORMSemaphore) Lost() <-chan struct{} {
+	return s.keeper.lost()
+}
+
+// createSlots creates the slots of the semaphore which do not exist yet.
+func (s *GORMSemaphore) createSlots(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+
+	var count int64
+	if err := db.Model(&SemaphoreSlot{}).Where("name = ? AND slot < ?", s.name, s.capacity).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= s.capacity {
+		return nil
+	}
+
+	now := time.Now()
+	slots := make([]SemaphoreSlot, s.capacity)
+	for i := range slots {
+		slots[i] = SemaphoreSlot{Name: s.name, Slot: int64(i), ExpiredAt: now}
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&slots).Error
+}
@@ -0,0 +1,205 @@
+package distlock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// RedisSemaphore implements Semaphore using a Redis sorted set. Every permit
+// is a member of the set, scored by the expiration time of its lease.
+type RedisSemaphore struct {
+	client      *redis.Client
+	name        string
+	capacity    int64
+	lockTimeout time.Duration
+	backoff     wait.Backoff
+	clock       clock.WithTicker
+	keeper      *leaseKeeper
+	mu          sync.Mutex
+	ownerID     string
+	permits     []string // IDs of the permits held by this instance
+	logger      logger.Logger
+}
+
+// semaphoreAcquireScript removes the expired permits and adds the permits
+// given in ARGV[3:] if that does not exceed the capacity given in ARGV[1].
+// It returns 1 on success and 0 if not enough permits are available.
+var semaphoreAcquireScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) + #ARGV - 2 > tonumber(ARGV[1]) then
+	return 0
+end
+for i = 3, #ARGV do
+	redis.call("ZADD", KEYS[1], now + tonumber(ARGV[2]), ARGV[i])
+end
+local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+redis.call("PEXPIREAT", KEYS[1], last[2])
+return 1
+`)
+
+// semaphoreRenewScript extends the leases of the permits given in ARGV[2:].
+// It returns 1 on success and 0 if any of them has expired.
+var semaphoreRenewScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+for i = 2, #ARGV do
+	local score = redis.call("ZSCORE", KEYS[1], ARGV[i])
+	if not score or tonumber(score) <= now then
+		return 0
+	end
+end
+for i = 2, #ARGV do
+	redis.call("ZADD", KEYS[1], now + tonumber(ARGV[1]), ARGV[i])
+end
+local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+redis.call("PEXPIREAT", KEYS[1], last[2])
+return 1
+`)
+
+// Ensure RedisSemaphore implements the Semaphore interface.
+var _ Semaphore = (*RedisSemaphore)(nil)
+
+// NewRedisSemaphore creates a new RedisSemaphore instance.
+// The lock name is used as the name of the semaphore.
+func NewRedisSemaphore(client *redis.Client, opts ...Option) *RedisSemaphore {
+	o := ApplyOptions(opts...)
+	semaphore := &RedisSemaphore{
+		client:      client,
+		name:        o.lockName,
+		capacity:    o.capacity,
+		lockTimeout: o.lockTimeout,
+		backoff:     o.backoff,
+		clock:       o.clock,
+		keeper:      newLeaseKeeper(o),
+		ownerID:     o.ownerID,
+		logger:      o.logger,
+	}
+
+	semaphore.logger.Info("RedisSemaphore initialized", "name", semaphore.name, "capacity", semaphore.capacity, "ownerID", semaphore.ownerID)
+	return semaphore
+}
+
+// Acquire blocks until n permits are acquired or ctx is done.
+func (s *RedisSemaphore) Acquire(ctx context.Context, n int64) error {
+	if err := validatePermits(n, s.capacity); err != nil {
+		return err
+	}
+
+	return acquirePermits(ctx, s.backoff, s.clock, s.logger, func(ctx context.Context) error {
+		return s.TryAcquire(ctx, n)
+	})
+}
+
+// TryAcquire attempts to acquire n permits without blocking.
+func (s *RedisSemaphore) TryAcquire(ctx context.Context, n int64) error {
+	if err := validatePermits(n, s.capacity); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permits := make([]string, n)
+	args := []any{s.capacity, s.lockTimeout.Milliseconds()}
+	for i := range permits {
+		permits[i] = s.ownerID + ":" + uuid.NewString()
+		args = append(args, permits[i])
+	}
+
+	result, err := semaphoreAcquireScript.Run(ctx, s.client, []string{s.name}, args...).Int64()
+	if err != nil {
+		s.logger.Error("Failed to acquire permits", "error", err)
+		return err
+	}
+	if result == 0 {
+		s.logger.Debug("Not enough permits available", "name", s.name, "permits", n)
+		return fmt.Errorf("%w for %d permits", ErrNoPermits, n)
+	}
+
+	if !s.keeper.running() {
+		s.keeper.start(ctx, s.Renew)
+	}
+	s.permits = append(s.permits, permits...)
+
+	s.logger.Info("Permits acquired", "name", s.name, "permits", n, "held", len(s.permits))
+	return nil
+}
+
+// Release releases n of the permits held by this instance.
+func (s *RedisSemaphore) Release(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 || n > int64(len(s.permits)) {
+		return fmt.Errorf("cannot release %d permits, %d are held", n, len(s.permits))
+	}
+
+	released := s.permits[int64(len(s.permits))-n:]
+	s.permits = s.permits[:int64(len(s.permits))-n]
+	if len(s.permits) == 0 && s.keeper.stop() {
+		s.logger.Info("Stopped renewing permits", "name", s.name)
+	}
+
+	members := make([]any, len(released))
+	for i, permit := range released {
+		members[i] = permit
+	}
+	removed, err := s.client.ZRem(ctx, s.name, members...).Result()
+	if err != nil {
+		s.logger.Error("Failed to release permits", "error", err)
+		return err
+	}
+	if removed < n {
+		s.logger.Warn("Some permits have expired before being released", "name", s.name, "permits", n, "released", removed)
+		return ErrLockLost
+	}
+
+	s.logger.Info("Permits released", "name", s.name, "permits", n, "held", len(s.permits))
+	return nil
+}
+
+// Renew extends the leases of all permits held by this instance.
+func (s *RedisSemaphore) Renew(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.permits) == 0 {
+		return nil
+	}
+
+	args := []any{s.lockTimeout.Milliseconds()}
+	for _, permit := range s.permits {
+		args = append(args, permit)
+	}
+	result, err := semaphoreRenewScript.Run(ctx, s.client, []string{s.name}, args...).Int64()
+	if err != nil {
+		s.logger.Error("Failed to renew permits", "error", err)
+		return err
+	}
+	if result == 0 {
+		// Forget the permits, so that acquiring new ones starts a new lease
+		s.logger.Warn("Permits have expired", "name", s.name)
+		s.permits = nil
+		return ErrLockLost
+	}
+
+	s.logger.Info("Permits renewed", "name", s.name, "held", len(s.permits))
+	return nil
+}
+
+// Lost returns a channel which is closed when the permits, once acquired, are
+// lost because they could not be renewed in time.
+func (s *RedisSemaphore) Lost() <-chan struct{} {
+	return s.keeper.lost()
+}
@@ -3,6 +3,7 @@ package distlock
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,19 +14,25 @@ import (
 
 // ZookeeperLocker provides a distributed locking mechanism using Zookeeper.
 type ZookeeperLocker struct {
-	conn        *zk.Conn
-	lockPath    string
-	lockTimeout time.Duration
-	renewTicker *time.Ticker
-	stopChan    chan struct{}
-	mu          sync.Mutex
-	ownerID     string // Records the owner ID
-	logger      logger.Logger
+	conn            *zk.Conn
+	lockPath        string
+	lockTimeout     time.Duration
+	keeper          *leaseKeeper
+	instrumentation *Instrumentation
+	mu              sync.Mutex
+	ownerID         string // Records the owner ID
+	logger          logger.Logger
 }
 
 // Ensure ZookeeperLocker implements the Locker interface.
 var _ Locker = (*ZookeeperLocker)(nil)
 
+// Ensure ZookeeperLocker implements the ReleaseNotifier interface.
+var _ ReleaseNotifier = (*ZookeeperLocker)(nil)
+
+// Ensure ZookeeperLocker implements the HolderInspector interface.
+var _ HolderInspector = (*ZookeeperLocker)(nil)
+
 // NewZookeeperLocker creates a new ZookeeperLocker instance.
 func NewZookeeperLocker(zkServers []string, opts ...Option) (*ZookeeperLocker, error) {
 	o := ApplyOptions(opts...)
@@ -35,12 +42,13 @@ func NewZookeeperLocker(zkServers []string, opts ...Option) (*ZookeeperLocker, e
 	}
 
 	locker := &ZookeeperLocker{
-		conn:        conn,
-		lockPath:    o.lockName,
-		lockTimeout: o.lockTimeout,
-		stopChan:    make(chan struct{}),
-		ownerID:     o.ownerID,
-		logger:      o.logger,
+		conn:            conn,
+		lockPath:        o.lockName,
+		lockTimeout:     o.lockTimeout,
+		keeper:          newLeaseKeeper(o),
+		instrumentation: o.instrumentation,
+		ownerID:         o.ownerID,
+		logger:          o.logger,
 	}
 
 	locker.logger.Info("ZookeeperLocker initialized", "lockPath", locker.lockPath, "ownerID", locker.ownerID)
@@ -48,75 +56,170 @@ func NewZookeeperLocker(zkServers []string, opts ...Option) (*ZookeeperLocker, e
 }
 
 // Lock attempts to acquire the distributed lock.
-func (l *ZookeeperLocker) Lock(ctx context.Context) error {
+// The lock is an ephemeral node holding the owner ID, so it goes away together
+// with the session of a crashed holder. The zxid that created the node is used
+// as the fencing token.
+func (l *ZookeeperLocker) Lock(ctx context.Context) (int64, error) {
+	return l.instrumentation.lock(ctx, l.lockPath, l.ownerID, l.lock)
+}
+
+// lock implements Lock.
+func (l *ZookeeperLocker) lock(ctx context.Context) (int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Create the lock node
-	lockNode := fmt.Sprintf("%s/%s", l.lockPath, l.ownerID)
-	_, err := l.conn.Create(lockNode, []byte{}, 0, zk.WorldACL(zk.PermAll))
+	lockNode := l.lockNode()
+	_, err := l.conn.Create(lockNode, []byte(l.ownerID), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
 	if err != nil {
 		if err == zk.ErrNodeExists {
-			l.logger.Warn("Lock is already held by another owner", "lockNode", lockNode)
-			return fmt.Errorf("lock is already held by another owner")
+			currentOwnerID, _, _ := l.conn.Get(lockNode)
+			l.logger.Warn("Lock is already held by another owner", "lockNode", lockNode, "currentOwnerID", string(currentOwnerID))
+			return 0, fmt.Errorf("%w by %s", ErrLockHeld, currentOwnerID)
 		}
 		l.logger.Error("Failed to acquire lock", "error", err)
-		return fmt.Errorf("failed to acquire lock: %v", err)
+		return 0, fmt.Errorf("failed to acquire lock: %v", err)
 	}
 
+	_, stat, err := l.conn.Exists(lockNode)
+	if err == nil && stat == nil {
+		err = zk.ErrNoNode
+	}
+	if err != nil {
+		// Do not leave the node behind, it would hold the lock until the session expires
+		_ = l.conn.Delete(lockNode, -1)
+		l.logger.Error("Failed to read lock node", "error", err)
+		return 0, fmt.Errorf("failed to read lock node: %v", err)
+	}
+	token := stat.Czxid
+
 	// Start the renewal goroutine
-	l.renewTicker = time.NewTicker(l.lockTimeout / 2)
-	go l.renewLock(ctx, lockNode)
+	l.keeper.start(ctx, l.Renew)
 
-	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "lockNode", lockNode)
-	return nil
+	l.logger.Info("Lock acquired", "ownerID", l.ownerID, "lockNode", lockNode, "token", token)
+	return token, nil
 }
 
 // Unlock releases the distributed lock.
 func (l *ZookeeperLocker) Unlock(ctx context.Context) error {
+	return l.instrumentation.unlock(ctx, l.lockPath, l.ownerID, l.unlock)
+}
+
+// unlock implements Unlock.
+func (l *ZookeeperLocker) unlock(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	lockNode := l.lockNode()
+
 	// Stop the renewal process
-	if l.renewTicker != nil {
-		l.renewTicker.Stop()
-		l.renewTicker = nil
-		l.logger.Info("Stopped renewing lock", "lockNode", fmt.Sprintf("%s/%s", l.lockPath, l.ownerID))
+	if l.keeper.stop() {
+		l.logger.Info("Stopped renewing lock", "lockNode", lockNode)
 	}
 
-	// Delete the lock node
-	lockNode := fmt.Sprintf("%s/%s", l.lockPath, l.ownerID)
-	err := l.conn.Delete(lockNode, -1)
+	// Delete the lock node, but only if it still belongs to us
+	data, stat, err := l.conn.Get(lockNode)
+	if err == zk.ErrNoNode {
+		return ErrLockLost
+	}
 	if err != nil {
 		l.logger.Error("Failed to release lock", "error", err)
 		return fmt.Errorf("failed to release lock: %v", err)
 	}
+	if string(data) != l.ownerID {
+		return ErrNotOwner
+	}
+	if err := l.conn.Delete(lockNode, stat.Version); err != nil {
+		l.logger.Error("Failed to release lock", "error", err)
+		return fmt.Errorf("failed to release lock: %v", err)
+	}
 
 	l.logger.Info("Lock released", "ownerID", l.ownerID)
-	l.ownerID = "" // Clear the owner ID
 	return nil
 }
 
+// NotifyRelease implements ReleaseNotifier using Zookeeper watches.
+func (l *ZookeeperLocker) NotifyRelease(ctx context.Context) (<-chan struct{}, error) {
+	lockNode := l.lockNode()
+	exists, _, events, err := l.conn.ExistsW(lockNode)
+	if err != nil {
+		return nil, err
+	}
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		for exists {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				if event.Type == zk.EventNodeDeleted {
+					return
+				}
+				// Watches fire only once, so set a new one for any other event.
+				exists, _, events, err = l.conn.ExistsW(lockNode)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return released, nil
+}
+
 // Renew refreshes the lock's expiration time.
 func (l *ZookeeperLocker) Renew(ctx context.Context) error {
+	return l.instrumentation.renew(ctx, l.lockPath, l.ownerID, l.renew)
+}
+
+// renew implements Renew.
+func (l *ZookeeperLocker) renew(ctx context.Context) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	// Simulate the renewal operation
+	// The ephemeral node lives as long as the Zookeeper session, which is kept
+	// alive by the client. Only check that the node still belongs to us.
+	data, _, err := l.conn.Get(l.lockNode())
+	if err == zk.ErrNoNode {
+		return ErrLockLost
+	}
+	if err != nil {
+		l.logger.Error("Failed to renew lock", "error", err)
+		return fmt.Errorf("failed to renew lock: %v", err)
+	}
+	if string(data) != l.ownerID {
+		return ErrNotOwner
+	}
+
 	l.logger.Info("Lock renewed", "ownerID", l.ownerID)
 	return nil
 }
 
-// renewLock periodically renews the lock.
-func (l *ZookeeperLocker) renewLock(ctx context.Context, lockNode string) {
-	for {
-		select {
-		case <-l.stopChan:
-			return
-		case <-l.renewTicker.C:
-			if err := l.Renew(ctx); err != nil {
-				l.logger.Error("Failed to renew lock", "error", err)
-			}
-		}
+// Holder implements HolderInspector by reading the lock node.
+func (l *ZookeeperLocker) Holder(ctx context.Context) (string, int64, error) {
+	data, stat, err := l.conn.Get(l.lockNode())
+	if err == zk.ErrNoNode {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return string(data), stat.Czxid, nil
+}
+
+// lockNode returns the absolute path of the node representing the lock.
+func (l *ZookeeperLocker) lockNode() string {
+	if strings.HasPrefix(l.lockPath, "/") {
+		return l.lockPath
 	}
+	return "/" + l.lockPath
+}
+
+// Lost returns a channel which is closed when the lock, once acquired, is lost
+// because it could not be renewed in time.
+func (l *ZookeeperLocker) Lost() <-chan struct{} {
+	return l.keeper.lost()
 }
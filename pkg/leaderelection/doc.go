@@ -0,0 +1,7 @@
+// Package leaderelection implements leader election on top of distlock.Locker.
+//
+// The instance holding the lock is the leader and the fencing token of its
+// acquisition is its term. Candidates call Run, which campaigns for the lock,
+// invokes the LeaderCallbacks and campaigns again whenever leadership is lost,
+// until its context is done.
+package leaderelection // import "github.com/LiangNing7/goutils/pkg/leaderelection"
@@ -0,0 +1,303 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/logger"
+)
+
+// ErrLeaderUnknown is returned by Leader when this instance is not the leader
+// and the locker cannot tell who holds the lock.
+var ErrLeaderUnknown = errors.New("leader is unknown")
+
+// LeaderCallbacks are invoked when the leadership changes. All of them are optional.
+type LeaderCallbacks struct {
+	// OnStartedLeading is called in its own goroutine when this instance becomes
+	// the leader. ctx is cancelled when the leadership is lost or given up, and
+	// the function is expected to return soon afterwards.
+	OnStartedLeading func(ctx context.Context)
+
+	// OnStoppedLeading is called when this instance stops being the leader,
+	// after OnStartedLeading has returned.
+	OnStoppedLeading func()
+
+	// OnNewLeader is called when a new leader is observed, this instance
+	// included. Other leaders are only observed while Run is running and the
+	// locker implements distlock.HolderInspector.
+	OnNewLeader func(identity string)
+}
+
+// Leader describes the leader of an election.
+type Leader struct {
+	// Identity is the identity of the leader, empty if nobody leads.
+	Identity string
+	// Term is the fencing token of the lock acquisition that made the leader.
+	Term int64
+}
+
+// LeaderElector takes part in a leader election on behalf of this instance.
+type LeaderElector struct {
+	locker      *distlock.BlockingLocker
+	inspector   distlock.HolderInspector // nil if the locker cannot report the holder
+	callbacks   LeaderCallbacks
+	identity    string
+	retryPeriod time.Duration
+	logger      logger.Logger
+
+	mu       sync.Mutex
+	current  *leadership // The latest leadership of this instance, if any
+	observed string      // The identity of the leader reported to OnNewLeader last
+}
+
+// leadership is a single term during which this instance is the leader.
+type leadership struct {
+	term     int64
+	cancel   context.CancelFunc // Cancels the context passed to OnStartedLeading
+	running  chan struct{}      // Closed when OnStartedLeading returns
+	stopping chan struct{}      // Closed when stepping down begins
+	stopped  chan struct{}      // Closed when stepping down is complete
+}
+
+// NewLeaderElector creates a new LeaderElector which campaigns with the given
+// locker. The locker should not be used for anything else.
+func NewLeaderElector(locker distlock.Locker, callbacks LeaderCallbacks, opts ...Option) *LeaderElector {
+	o := ApplyOptions(opts...)
+
+	inspector, _ := locker.(distlock.HolderInspector)
+	return &LeaderElector{
+		locker: distlock.NewBlockingLocker(locker, distlock.WithLogger(o.logger), distlock.WithBackoff(wait.Backoff{
+			Duration: o.retryPeriod,
+			Jitter:   0.2,
+		})),
+		inspector:   inspector,
+		callbacks:   callbacks,
+		identity:    o.identity,
+		retryPeriod: o.retryPeriod,
+		logger:      o.logger,
+	}
+}
+
+// Run campaigns for leadership until ctx is done, at which point it resigns
+// and returns. Whenever the leadership is lost or given up with Resign, Run
+// waits for a retry period, so that other candidates have a chance to take
+// over, and then campaigns again.
+func (le *LeaderElector) Run(ctx context.Context) {
+	if le.inspector != nil {
+		go func() {
+			for leader := range le.Observe(ctx) {
+				le.reportLeader(leader.Identity)
+			}
+		}()
+	}
+
+	for {
+		if _, err := le.Campaign(ctx); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := le.Resign(context.WithoutCancel(ctx)); err != nil {
+				le.logger.Warn("Failed to resign leadership", "identity", le.identity, "error", err)
+			}
+			return
+		case <-le.leadership().stopping:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(le.retryPeriod):
+		}
+	}
+}
+
+// Campaign blocks until this instance becomes the leader or ctx is done, and
+// returns the term of the leadership. It returns at once if this instance is
+// already the leader.
+func (le *LeaderElector) Campaign(ctx context.Context) (int64, error) {
+	if term := le.Term(); term != 0 {
+		return term, nil
+	}
+
+	term, err := le.locker.LockWait(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	l := &leadership{
+		term:     term,
+		cancel:   cancel,
+		running:  make(chan struct{}),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	le.mu.Lock()
+	le.current = l
+	le.mu.Unlock()
+
+	le.logger.Info("Became the leader", "identity", le.identity, "term", term)
+	le.reportLeader(le.identity)
+
+	go func() {
+		defer close(l.running)
+		if le.callbacks.OnStartedLeading != nil {
+			le.callbacks.OnStartedLeading(leaderCtx)
+		}
+	}()
+	go le.watchLease(l)
+
+	return term, nil
+}
+
+// Resign gives up the leadership, if this instance is the leader. It waits
+// for OnStartedLeading to return before releasing the lock, so it must not be
+// called from within OnStartedLeading.
+func (le *LeaderElector) Resign(ctx context.Context) error {
+	l := le.leadership()
+	if l == nil || !le.stepDown(l) {
+		return nil
+	}
+
+	le.logger.Info("Resigned leadership", "identity", le.identity, "term", l.term)
+	return le.locker.Unlock(ctx)
+}
+
+// IsLeader reports whether this instance is the leader.
+func (le *LeaderElector) IsLeader() bool {
+	return le.Term() != 0
+}
+
+// Term returns the term of the leadership of this instance, or 0 if this
+// instance is not the leader.
+func (le *LeaderElector) Term() int64 {
+	l := le.leadership()
+	if l == nil {
+		return 0
+	}
+
+	select {
+	case <-l.stopping:
+		return 0
+	default:
+		return l.term
+	}
+}
+
+// Leader returns the current leader. If this instance is not the leader, the
+// holder of the lock is asked for, which requires the locker to implement
+// distlock.HolderInspector. Otherwise ErrLeaderUnknown is returned.
+func (le *LeaderElector) Leader(ctx context.Context) (Leader, error) {
+	if term := le.Term(); term != 0 {
+		return Leader{Identity: le.identity, Term: term}, nil
+	}
+
+	if le.inspector == nil {
+		return Leader{}, ErrLeaderUnknown
+	}
+
+	identity, term, err := le.inspector.Holder(ctx)
+	if err != nil {
+		return Leader{}, err
+	}
+	return Leader{Identity: identity, Term: term}, nil
+}
+
+// Observe polls the current leader every retry period and sends it to the
+// returned channel whenever it changes. The channel is closed when ctx is done.
+func (le *LeaderElector) Observe(ctx context.Context) <-chan Leader {
+	leaders := make(chan Leader)
+	go func() {
+		defer close(leaders)
+
+		ticker := time.NewTicker(le.retryPeriod)
+		defer ticker.Stop()
+
+		var last Leader
+		observed := false
+		for {
+			leader, err := le.Leader(ctx)
+			if err != nil {
+				le.logger.Debug("Failed to observe the leader", "error", err)
+			} else if !observed || leader != last {
+				select {
+				case <-ctx.Done():
+					return
+				case leaders <- leader:
+				}
+				last, observed = leader, true
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return leaders
+}
+
+// leadership returns the latest leadership of this instance.
+func (le *LeaderElector) leadership() *leadership {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	return le.current
+}
+
+// watchLease steps down as soon as the lock of the given leadership is lost.
+func (le *LeaderElector) watchLease(l *leadership) {
+	select {
+	case <-l.stopping:
+	case <-le.locker.Lost():
+		le.logger.Warn("Lost leadership", "identity", le.identity, "term", l.term)
+		le.stepDown(l)
+	}
+}
+
+// stepDown ends the given leadership and runs the callbacks. It returns false
+// if the leadership was already ending, in which case it waits for that to
+// complete.
+func (le *LeaderElector) stepDown(l *leadership) bool {
+	le.mu.Lock()
+	select {
+	case <-l.stopping:
+		le.mu.Unlock()
+		<-l.stopped
+		return false
+	default:
+		close(l.stopping)
+	}
+	le.mu.Unlock()
+
+	l.cancel()
+	<-l.running
+	if le.callbacks.OnStoppedLeading != nil {
+		le.callbacks.OnStoppedLeading()
+	}
+
+	close(l.stopped)
+	return true
+}
+
+// reportLeader calls OnNewLeader if the given leader differs from the one
+// reported last.
+func (le *LeaderElector) reportLeader(identity string) {
+	le.mu.Lock()
+	changed := identity != le.observed
+	le.observed = identity
+	le.mu.Unlock()
+
+	if changed && identity != "" && le.callbacks.OnNewLeader != nil {
+		le.callbacks.OnNewLeader(identity)
+	}
+}
@@ -0,0 +1,232 @@
+package leaderelection_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/leaderelection"
+)
+
+// recorder 按顺序记录回调.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// callbacks 返回记录所有回调的 LeaderCallbacks, OnStartedLeading 一直运行到 ctx 被取消.
+func (r *recorder) callbacks() leaderelection.LeaderCallbacks {
+	return leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(ctx context.Context) {
+			r.record("started")
+			<-ctx.Done()
+			r.record("returned")
+		},
+		OnStoppedLeading: func() {
+			r.record("stopped")
+		},
+		OnNewLeader: func(identity string) {
+			r.record("leader:" + identity)
+		},
+	}
+}
+
+// newElectors 为每个身份创建一个 LeaderElector, 它们共享同一把内存锁和同一个假时钟.
+func newElectors(clock *clocktesting.FakeClock, recorders map[string]*recorder, identities ...string) []*leaderelection.LeaderElector {
+	registry := distlock.NewMemoryRegistry()
+
+	electors := make([]*leaderelection.LeaderElector, 0, len(identities))
+	for _, identity := range identities {
+		locker := distlock.NewMemoryLocker(registry,
+			distlock.WithLockName("leader"),
+			distlock.WithOwnerID(identity),
+			distlock.WithLockTimeout(10*time.Second),
+			distlock.WithClock(clock),
+		)
+		r := &recorder{}
+		recorders[identity] = r
+		electors = append(electors, leaderelection.NewLeaderElector(locker, r.callbacks(),
+			leaderelection.WithIdentity(identity),
+			leaderelection.WithRetryPeriod(10*time.Millisecond),
+		))
+	}
+	return electors
+}
+
+func TestLeaderElector_CampaignAndResign(t *testing.T) {
+	ctx := context.Background()
+	recorders := map[string]*recorder{}
+	electors := newElectors(clocktesting.NewFakeClock(time.Now()), recorders, "a", "b")
+	a, b := electors[0], electors[1]
+
+	termA, err := a.Campaign(ctx)
+	require.NoError(t, err)
+	assert.Positive(t, termA)
+	assert.True(t, a.IsLeader())
+	assert.Equal(t, termA, a.Term())
+	assert.False(t, b.IsLeader())
+	assert.Zero(t, b.Term())
+
+	// 再次竞选直接返回当前任期
+	term, err := a.Campaign(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, termA, term)
+
+	// 非 leader 通过锁的持有者得知 leader
+	leader, err := a.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, leaderelection.Leader{Identity: "a", Term: termA}, leader)
+	leader, err = b.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, leaderelection.Leader{Identity: "a", Term: termA}, leader)
+
+	// a 辞职前 b 的竞选一直阻塞
+	termCh := make(chan int64, 1)
+	go func() {
+		term, err := b.Campaign(ctx)
+		assert.NoError(t, err)
+		termCh <- term
+	}()
+	assert.Never(t, func() bool { return len(termCh) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	require.NoError(t, a.Resign(ctx))
+	assert.False(t, a.IsLeader())
+	assert.Equal(t, []string{"leader:a", "started", "returned", "stopped"}, recorders["a"].list())
+
+	// 领导权转移给 b, 且任期更大
+	var termB int64
+	require.Eventually(t, func() bool {
+		select {
+		case termB = <-termCh:
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Greater(t, termB, termA)
+	assert.True(t, b.IsLeader())
+	require.Eventually(t, func() bool {
+		return len(recorders["b"].list()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"leader:b", "started"}, recorders["b"].list())
+
+	leader, err = a.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, leaderelection.Leader{Identity: "b", Term: termB}, leader)
+
+	// 不是 leader 时辞职什么也不做
+	require.NoError(t, a.Resign(ctx))
+	require.NoError(t, b.Resign(ctx))
+	assert.Equal(t, []string{"leader:b", "started", "returned", "stopped"}, recorders["b"].list())
+}
+
+func TestLeaderElector_LeaseLost(t *testing.T) {
+	ctx := context.Background()
+	clock := clocktesting.NewFakeClock(time.Now())
+	recorders := map[string]*recorder{}
+	a := newElectors(clock, recorders, "a")[0]
+
+	_, err := a.Campaign(ctx)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(recorders["a"].list()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// 租约过期后无法续约, leader 主动下台
+	clock.Step(11 * time.Second)
+	require.Eventually(t, func() bool {
+		return !a.IsLeader() && len(recorders["a"].list()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"leader:a", "started", "returned", "stopped"}, recorders["a"].list())
+}
+
+func TestLeaderElector_Observe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	recorders := map[string]*recorder{}
+	electors := newElectors(clocktesting.NewFakeClock(time.Now()), recorders, "a", "b")
+	a, b := electors[0], electors[1]
+
+	leaders := b.Observe(ctx)
+	assert.Equal(t, leaderelection.Leader{}, <-leaders)
+
+	term, err := a.Campaign(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, leaderelection.Leader{Identity: "a", Term: term}, <-leaders)
+
+	require.NoError(t, a.Resign(ctx))
+	assert.Equal(t, leaderelection.Leader{}, <-leaders)
+
+	// ctx 取消后通道被关闭
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-leaders:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLeaderElector_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	recorders := map[string]*recorder{}
+	electors := newElectors(clocktesting.NewFakeClock(time.Now()), recorders, "a", "b")
+	a, b := electors[0], electors[1]
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Run(ctx)
+	}()
+	require.Eventually(t, a.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	// 另一个候选者运行时会观察到 a 成为 leader
+	bCtx, bCancel := context.WithCancel(context.Background())
+	bDone := make(chan struct{})
+	go func() {
+		defer close(bDone)
+		b.Run(bCtx)
+	}()
+	require.Eventually(t, func() bool {
+		events := recorders["b"].list()
+		return len(events) > 0 && events[0] == "leader:a"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// ctx 取消后 Run 辞职并返回, 领导权转移给 b
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+	assert.False(t, a.IsLeader())
+	assert.Equal(t, []string{"leader:a", "started", "returned", "stopped"}, recorders["a"].list())
+	require.Eventually(t, b.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	bCancel()
+	select {
+	case <-bDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+	assert.False(t, b.IsLeader())
+}
@@ -0,0 +1,63 @@
+package leaderelection
+
+import (
+	"os"
+	"time"
+
+	"github.com/LiangNing7/goutils/pkg/logger"
+	"github.com/LiangNing7/goutils/pkg/logger/empty"
+)
+
+// Options holds the configuration for a LeaderElector.
+type Options struct {
+	identity    string        // Identity of this candidate
+	retryPeriod time.Duration // Interval between attempts to acquire the lock or observe the leader
+	logger      logger.Logger // Logger for logging events
+}
+
+// Option is a function that modifies Options.
+type Option func(o *Options)
+
+// NewOptions initializes Options with default values.
+func NewOptions() *Options {
+	identity, _ := os.Hostname() // Same default as the owner ID of distlock
+	return &Options{
+		identity:    identity,
+		retryPeriod: 2 * time.Second,
+		logger:      empty.NewLogger(),
+	}
+}
+
+// ApplyOptions applies a series of Option functions to configure Options.
+func ApplyOptions(opts ...Option) *Options {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithIdentity sets the identity of this candidate. It must be the same as
+// the owner ID of the locker, otherwise this candidate does not recognize
+// itself when observing the leader.
+func WithIdentity(identity string) Option {
+	return func(o *Options) {
+		o.identity = identity
+	}
+}
+
+// WithRetryPeriod sets how long to wait between attempts to acquire the lock,
+// and how often the current leader is observed.
+func WithRetryPeriod(period time.Duration) Option {
+	return func(o *Options) {
+		o.retryPeriod = period
+	}
+}
+
+// WithLogger sets the logger in Options.
+func WithLogger(logger logger.Logger) Option {
+	return func(o *Options) {
+		o.logger = logger
+	}
+}
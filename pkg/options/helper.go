@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	netutils "k8s.io/utils/net"
+
+	"github.com/LiangNing7/goutils/pkg/db"
 )
 
 // Define unit constant.
@@ -63,3 +66,12 @@ func CreateListener(addr string) (net.Listener, int, error) {
 
 	return ln, tcpAddr.Port, nil
 }
+
+// tracePlugin returns the plugin tracing the SQL statements, or nil if
+// tracing is disabled.
+func tracePlugin(enable bool, slowThreshold time.Duration, redactParams bool) *db.TracePlugin {
+	if !enable {
+		return nil
+	}
+	return &db.TracePlugin{SlowThreshold: slowThreshold, RedactParams: redactParams}
+}
@@ -24,6 +24,12 @@ type MySQLOptions struct {
 	MaxOpenConnections    int           `json:"max-open-connections,omitempty" mapstructure:"max-open-connections"`
 	MaxConnectionLifeTime time.Duration `json:"max-connection-life-time,omitempty" mapstructure:"max-connection-life-time"`
 	LogLevel              int           `json:"log-level" mapstructure:"log-level"`
+	Replicas              []string      `json:"replicas,omitempty" mapstructure:"replicas"`
+	ReplicaPolicy         string        `json:"replica-policy,omitempty" mapstructure:"replica-policy"`
+	// tracing switch
+	EnableTrace   bool          `json:"enable-trace" mapstructure:"enable-trace"`
+	SlowThreshold time.Duration `json:"slow-threshold,omitempty" mapstructure:"slow-threshold"`
+	RedactParams  bool          `json:"redact-params" mapstructure:"redact-params"`
 }
 
 // NewMySQLOptions create a `zero` value instance.
@@ -37,6 +43,8 @@ func NewMySQLOptions() *MySQLOptions {
 		MaxOpenConnections:    100,
 		MaxConnectionLifeTime: time.Duration(10) * time.Second,
 		LogLevel:              1, // Silent
+		RedactParams:          true,
+		ReplicaPolicy:         db.ReplicaPolicyRandom,
 	}
 }
 
@@ -44,6 +52,10 @@ func NewMySQLOptions() *MySQLOptions {
 func (o *MySQLOptions) Validate() []error {
 	errs := []error{}
 
+	if _, err := db.NewReplicaPolicy(o.ReplicaPolicy); err != nil {
+		errs = append(errs, err)
+	}
+
 	return errs
 }
 
@@ -64,6 +76,16 @@ func (o *MySQLOptions) AddFlags(fs *pflag.FlagSet, prefixes ...string) {
 		"Maximum connection life time allowed to connect to mysql.")
 	fs.IntVar(&o.LogLevel, join(prefixes...)+"mysql.log-mode", o.LogLevel, ""+
 		"Specify gorm log level.")
+	fs.BoolVar(&o.EnableTrace, join(prefixes...)+"mysql.enable-trace", o.EnableTrace, ""+
+		"Trace the SQL statements (using open telemetry) and record their duration.")
+	fs.DurationVar(&o.SlowThreshold, join(prefixes...)+"mysql.slow-threshold", o.SlowThreshold, ""+
+		"Duration beyond which traced SQL statements are logged as slow queries, 0 disables the slow query log.")
+	fs.BoolVar(&o.RedactParams, join(prefixes...)+"mysql.redact-params", o.RedactParams, ""+
+		"Replace the parameters of traced SQL statements with placeholders in spans and logs, so that no data is leaked.")
+	fs.StringSliceVar(&o.Replicas, join(prefixes...)+"mysql.replicas", o.Replicas, ""+
+		"Addresses of the read replicas, which use the same credentials as the primary.")
+	fs.StringVar(&o.ReplicaPolicy, join(prefixes...)+"mysql.replica-policy", o.ReplicaPolicy, ""+
+		"Policy selecting the replica serving each read, one of random, round-robin and least-latency.")
 }
 
 // DSN return DSN from MySQLOptions.
@@ -79,7 +101,26 @@ func (o *MySQLOptions) DSN() string {
 
 // NewDB create mysql store with the given config.
 func (o *MySQLOptions) NewDB() (*gorm.DB, error) {
-	opts := &db.MySQLOptions{
+	return db.NewMySQL(o.dbOptions())
+}
+
+// NewCluster create mysql store with the given config, whose reads are
+// served by the replicas.
+func (o *MySQLOptions) NewCluster() (*db.Cluster, error) {
+	policy, err := db.NewReplicaPolicy(o.ReplicaPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := o.dbOptions()
+	opts.Replicas = o.Replicas
+	opts.ReplicaPolicy = policy
+	return db.NewMySQLCluster(opts)
+}
+
+// dbOptions converts o to the options of the db package.
+func (o *MySQLOptions) dbOptions() *db.MySQLOptions {
+	return &db.MySQLOptions{
 		Addr:                  o.Addr,
 		Username:              o.Username,
 		Password:              o.Password,
@@ -88,7 +129,6 @@ func (o *MySQLOptions) NewDB() (*gorm.DB, error) {
 		MaxOpenConnections:    o.MaxOpenConnections,
 		MaxConnectionLifeTime: o.MaxConnectionLifeTime,
 		Logger:                log.Default().LogMode(gormlogger.LogLevel(o.LogLevel)),
+		TracePlugin:           tracePlugin(o.EnableTrace, o.SlowThreshold, o.RedactParams),
 	}
-
-	return db.NewMySQL(opts)
 }
@@ -23,6 +23,12 @@ type PostgreSQLOptions struct {
 	MaxOpenConnections    int           `json:"max-open-connections,omitempty" mapstructure:"max-open-connections"`
 	MaxConnectionLifeTime time.Duration `json:"max-connection-life-time,omitempty" mapstructure:"max-connection-life-time"`
 	LogLevel              int           `json:"log-level" mapstructure:"log-level"`
+	Replicas              []string      `json:"replicas,omitempty" mapstructure:"replicas"`
+	ReplicaPolicy         string        `json:"replica-policy,omitempty" mapstructure:"replica-policy"`
+	// tracing switch
+	EnableTrace   bool          `json:"enable-trace" mapstructure:"enable-trace"`
+	SlowThreshold time.Duration `json:"slow-threshold,omitempty" mapstructure:"slow-threshold"`
+	RedactParams  bool          `json:"redact-params" mapstructure:"redact-params"`
 }
 
 // NewPostgreSQLOptions create a `zero` value instance.
@@ -36,6 +42,8 @@ func NewPostgreSQLOptions() *PostgreSQLOptions {
 		MaxOpenConnections:    100,
 		MaxConnectionLifeTime: time.Duration(10) * time.Second,
 		LogLevel:              1, // Silent
+		RedactParams:          true,
+		ReplicaPolicy:         db.ReplicaPolicyRandom,
 	}
 }
 
@@ -43,6 +51,10 @@ func NewPostgreSQLOptions() *PostgreSQLOptions {
 func (o *PostgreSQLOptions) Validate() []error {
 	errs := []error{}
 
+	if _, err := db.NewReplicaPolicy(o.ReplicaPolicy); err != nil {
+		errs = append(errs, err)
+	}
+
 	return errs
 }
 
@@ -63,11 +75,40 @@ func (o *PostgreSQLOptions) AddFlags(fs *pflag.FlagSet, prefixes ...string) {
 		"Maximum connection life time allowed to connect to postgresql.")
 	fs.IntVar(&o.LogLevel, join(prefixes...)+"postgresql.log-mode", o.LogLevel, ""+
 		"Specify gorm log level.")
+	fs.BoolVar(&o.EnableTrace, join(prefixes...)+"postgresql.enable-trace", o.EnableTrace, ""+
+		"Trace the SQL statements (using open telemetry) and record their duration.")
+	fs.DurationVar(&o.SlowThreshold, join(prefixes...)+"postgresql.slow-threshold", o.SlowThreshold, ""+
+		"Duration beyond which traced SQL statements are logged as slow queries, 0 disables the slow query log.")
+	fs.BoolVar(&o.RedactParams, join(prefixes...)+"postgresql.redact-params", o.RedactParams, ""+
+		"Replace the parameters of traced SQL statements with placeholders in spans and logs, so that no data is leaked.")
+	fs.StringSliceVar(&o.Replicas, join(prefixes...)+"postgresql.replicas", o.Replicas, ""+
+		"Addresses of the read replicas, which use the same credentials as the primary.")
+	fs.StringVar(&o.ReplicaPolicy, join(prefixes...)+"postgresql.replica-policy", o.ReplicaPolicy, ""+
+		"Policy selecting the replica serving each read, one of random, round-robin and least-latency.")
 }
 
 // NewDB create postgresql store with the given config.
 func (o *PostgreSQLOptions) NewDB() (*gorm.DB, error) {
-	opts := &db.PostgreSQLOptions{
+	return db.NewPostgreSQL(o.dbOptions())
+}
+
+// NewCluster create postgresql store with the given config, whose reads are
+// served by the replicas.
+func (o *PostgreSQLOptions) NewCluster() (*db.Cluster, error) {
+	policy, err := db.NewReplicaPolicy(o.ReplicaPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := o.dbOptions()
+	opts.Replicas = o.Replicas
+	opts.ReplicaPolicy = policy
+	return db.NewPostgreSQLCluster(opts)
+}
+
+// dbOptions converts o to the options of the db package.
+func (o *PostgreSQLOptions) dbOptions() *db.PostgreSQLOptions {
+	return &db.PostgreSQLOptions{
 		Addr:                  o.Addr,
 		Username:              o.Username,
 		Password:              o.Password,
@@ -76,7 +117,6 @@ func (o *PostgreSQLOptions) NewDB() (*gorm.DB, error) {
 		MaxOpenConnections:    o.MaxOpenConnections,
 		MaxConnectionLifeTime: o.MaxConnectionLifeTime,
 		Logger:                log.Default().LogMode(gormlogger.LogLevel(o.LogLevel)),
+		TracePlugin:           tracePlugin(o.EnableTrace, o.SlowThreshold, o.RedactParams),
 	}
-
-	return db.NewPostgreSQL(opts)
 }
@@ -0,0 +1,97 @@
+package options
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+	"github.com/LiangNing7/goutils/pkg/log"
+)
+
+var _ IOptions = (*SQLiteOptions)(nil)
+
+// SQLiteOptions defines options for sqlite database.
+type SQLiteOptions struct {
+	Path                  string        `json:"path,omitempty" mapstructure:"path"`
+	InMemory              bool          `json:"in-memory,omitempty" mapstructure:"in-memory"`
+	BusyTimeout           time.Duration `json:"busy-timeout,omitempty" mapstructure:"busy-timeout"`
+	MaxIdleConnections    int           `json:"max-idle-connections,omitempty" mapstructure:"max-idle-connections,omitempty"`
+	MaxOpenConnections    int           `json:"max-open-connections,omitempty" mapstructure:"max-open-connections"`
+	MaxConnectionLifeTime time.Duration `json:"max-connection-life-time,omitempty" mapstructure:"max-connection-life-time"`
+	LogLevel              int           `json:"log-level" mapstructure:"log-level"`
+	// tracing switch
+	EnableTrace   bool          `json:"enable-trace" mapstructure:"enable-trace"`
+	SlowThreshold time.Duration `json:"slow-threshold,omitempty" mapstructure:"slow-threshold"`
+	RedactParams  bool          `json:"redact-params" mapstructure:"redact-params"`
+}
+
+// NewSQLiteOptions create a `zero` value instance.
+func NewSQLiteOptions() *SQLiteOptions {
+	return &SQLiteOptions{
+		Path:                  "onex.db",
+		BusyTimeout:           time.Duration(5) * time.Second,
+		MaxIdleConnections:    1,
+		MaxOpenConnections:    1,
+		MaxConnectionLifeTime: time.Duration(10) * time.Second,
+		LogLevel:              1, // Silent
+		RedactParams:          true,
+	}
+}
+
+// Validate verifies flags passed to SQLiteOptions.
+func (o *SQLiteOptions) Validate() []error {
+	errs := []error{}
+
+	if o.Path == "" && !o.InMemory {
+		errs = append(errs, fmt.Errorf("--sqlite.path can not be empty"))
+	}
+	if o.BusyTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--sqlite.busy-timeout cannot be negative"))
+	}
+
+	return errs
+}
+
+// AddFlags adds flags related to sqlite storage for a specific APIServer to the specified FlagSet.
+func (o *SQLiteOptions) AddFlags(fs *pflag.FlagSet, prefixes ...string) {
+	fs.StringVar(&o.Path, join(prefixes...)+"sqlite.path", o.Path, ""+
+		"Path of the sqlite database file, or name of the in-memory database with --sqlite.in-memory.")
+	fs.BoolVar(&o.InMemory, join(prefixes...)+"sqlite.in-memory", o.InMemory, ""+
+		"Keep the sqlite database in memory, shared by the connections of the pool. It is lost once the server exits.")
+	fs.DurationVar(&o.BusyTimeout, join(prefixes...)+"sqlite.busy-timeout", o.BusyTimeout, ""+
+		"Time a statement waits for the sqlite database to be unlocked before failing.")
+	fs.IntVar(&o.MaxIdleConnections, join(prefixes...)+"sqlite.max-idle-connections", o.MaxIdleConnections, ""+
+		"Maximum idle connections allowed to connect to sqlite.")
+	fs.IntVar(&o.MaxOpenConnections, join(prefixes...)+"sqlite.max-open-connections", o.MaxOpenConnections, ""+
+		"Maximum open connections allowed to connect to sqlite.")
+	fs.DurationVar(&o.MaxConnectionLifeTime, join(prefixes...)+"sqlite.max-connection-life-time", o.MaxConnectionLifeTime, ""+
+		"Maximum connection life time allowed to connect to sqlite.")
+	fs.IntVar(&o.LogLevel, join(prefixes...)+"sqlite.log-mode", o.LogLevel, ""+
+		"Specify gorm log level.")
+	fs.BoolVar(&o.EnableTrace, join(prefixes...)+"sqlite.enable-trace", o.EnableTrace, ""+
+		"Trace the SQL statements (using open telemetry) and record their duration.")
+	fs.DurationVar(&o.SlowThreshold, join(prefixes...)+"sqlite.slow-threshold", o.SlowThreshold, ""+
+		"Duration beyond which traced SQL statements are logged as slow queries, 0 disables the slow query log.")
+	fs.BoolVar(&o.RedactParams, join(prefixes...)+"sqlite.redact-params", o.RedactParams, ""+
+		"Replace the parameters of traced SQL statements with placeholders in spans and logs, so that no data is leaked.")
+}
+
+// NewDB create sqlite store with the given config.
+func (o *SQLiteOptions) NewDB() (*gorm.DB, error) {
+	opts := &db.SQLiteOptions{
+		Path:                  o.Path,
+		InMemory:              o.InMemory,
+		BusyTimeout:           o.BusyTimeout,
+		MaxIdleConnections:    o.MaxIdleConnections,
+		MaxOpenConnections:    o.MaxOpenConnections,
+		MaxConnectionLifeTime: o.MaxConnectionLifeTime,
+		Logger:                log.Default().LogMode(gormlogger.LogLevel(o.LogLevel)),
+		TracePlugin:           tracePlugin(o.EnableTrace, o.SlowThreshold, o.RedactParams),
+	}
+
+	return db.NewSQLite(opts)
+}
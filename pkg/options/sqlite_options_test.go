@@ -0,0 +1,42 @@
+package options_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/LiangNing7/goutils/pkg/options"
+)
+
+func TestSQLiteOptions_RedactParams(t *testing.T) {
+	// 开启追踪后默认隐藏 SQL 参数
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	opts := options.NewSQLiteOptions()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	opts.AddFlags(fs)
+	require.NoError(t, fs.Parse([]string{"--sqlite.path", filepath.Join(t.TempDir(), "test.db"), "--sqlite.enable-trace"}))
+	assert.True(t, opts.RedactParams)
+
+	db, err := opts.NewDB()
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE users (name TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO users (name) VALUES (?)", "s3cr3t").Error)
+
+	spans := recorder.Ended()
+	require.NotEmpty(t, spans)
+	for _, span := range spans {
+		for _, kv := range span.Attributes() {
+			assert.NotContains(t, kv.Value.Emit(), "s3cr3t")
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package audit provides a store.Hook recording who changed what: for each
+// object created, updated or deleted by a store.Store, the actor of the change
+// and the values of the changed fields are written to a Sink, either a
+// database table or a Kafka topic.
+package audit // import "github.com/LiangNing7/goutils/pkg/store/audit"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/LiangNing7/goutils/pkg/store"
+)
+
+// DefaultTable is the name of the audit table used by TableSink.
+const DefaultTable = "audit_records"
+
+// actorKey is the context key under which WithActor stores the actor.
+type actorKey struct{}
+
+// Record is the audit record of the change of an object.
+type Record struct {
+	ID int64 `gorm:"primaryKey" json:"id,omitempty"`
+	// Actor is who made the change, see WithActor.
+	Actor string `gorm:"size:255;index" json:"actor"`
+	// Entity is the changed model, by default its table name.
+	Entity string `gorm:"size:255;index:idx_audit_records_entity" json:"entity"`
+	// EntityID is the primary key of the changed object.
+	EntityID string `gorm:"size:255;index:idx_audit_records_entity" json:"entityID"`
+	// Operation is "create", "update" or "delete".
+	Operation string `gorm:"size:16" json:"operation"`
+	// Method is the store.Store method which made the change.
+	Method string `gorm:"size:64" json:"method"`
+	// Changes is the JSON encoded Changes of the object.
+	Changes   string    `gorm:"type:text" json:"changes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName returns the name of the audit table.
+func (*Record) TableName() string {
+	return DefaultTable
+}
+
+// Changes are the values of the changed fields of an object, keyed by their
+// JSON names. Creations only have After and deletions only have Before.
+type Changes struct {
+	Before map[string]json.RawMessage `json:"before,omitempty"`
+	After  map[string]json.RawMessage `json:"after,omitempty"`
+}
+
+// WithActor returns a copy of ctx carrying the actor of the changes made with
+// it, e.g. the authenticated user set by a middleware.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by ctx, or "" if there is none.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Option configures the Hook.
+type Option func(*options)
+
+type options struct {
+	actor  func(ctx context.Context) string
+	entity string
+}
+
+// WithActorFunc sets the function returning the actor of the changes made
+// with ctx, ActorFromContext by default.
+func WithActorFunc(fn func(ctx context.Context) string) Option {
+	return func(o *options) {
+		o.actor = fn
+	}
+}
+
+// WithEntity sets the entity of the records, the table name of the model by default.
+func WithEntity(entity string) Option {
+	return func(o *options) {
+		o.entity = entity
+	}
+}
+
+// Hook is a store.Hook writing the audit records of the mutations to a Sink.
+// Updates which do not change any field are not recorded, and neither are the
+// changes made by Store.Upsert, which does not call hooks.
+type Hook[T any] struct {
+	sink Sink
+	options
+}
+
+// Ensure Hook implements the store.Hook interface.
+var _ store.Hook[any] = (*Hook[any])(nil)
+
+// NewHook creates a new Hook writing to sink, to be passed to store.WithHooks.
+func NewHook[T any](sink Sink, opts ...Option) *Hook[T] {
+	h := &Hook[T]{sink: sink, options: options{actor: ActorFromContext}}
+	for _, opt := range opts {
+		opt(&h.options)
+	}
+	return h
+}
+
+// Before implements store.Hook. It does nothing.
+func (h *Hook[T]) Before(ctx context.Context, m *store.Mutation[T]) error {
+	return nil
+}
+
+// After implements store.Hook. It writes the records of the objects changed by m.
+func (h *Hook[T]) After(ctx context.Context, m *store.Mutation[T]) error {
+	tx, ok := store.TxFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("audit hook called without transaction")
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(new(T)); err != nil {
+		return err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+
+	entity := h.entity
+	if entity == "" {
+		entity = stmt.Schema.Table
+	}
+	actor := h.actor(ctx)
+	now := time.Now()
+
+	// Pair the objects as they were before and after the mutation by primary key
+	var (
+		keys    []string
+		changes = map[string]*Changes{}
+	)
+	add := func(key string, obj *T, after bool) error {
+		fields, err := fieldsOf(obj)
+		if err != nil {
+			return err
+		}
+		c, ok := changes[key]
+		if !ok {
+			c = &Changes{}
+			changes[key] = c
+			keys = append(keys, key)
+		}
+		if after {
+			c.After = fields
+		} else {
+			c.Before = fields
+		}
+		return nil
+	}
+	for _, obj := range m.Before {
+		if err := add(keyOf(ctx, pk, obj), obj, false); err != nil {
+			return err
+		}
+	}
+	for _, obj := range m.After {
+		if err := add(keyOf(ctx, pk, obj), obj, true); err != nil {
+			return err
+		}
+	}
+
+	records := make([]*Record, 0, len(keys))
+	for _, key := range keys {
+		c := changes[key]
+		if c.Before != nil && c.After != nil && !diff(c) {
+			continue
+		}
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		records = append(records, &Record{
+			Actor:     actor,
+			Entity:    entity,
+			EntityID:  key,
+			Operation: string(m.Operation),
+			Method:    m.Method,
+			Changes:   string(data),
+			CreatedAt: now,
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return h.sink.Write(ctx, records)
+}
+
+// keyOf returns the primary key of obj as a string.
+func keyOf[T any](ctx context.Context, pk *schema.Field, obj *T) string {
+	key, _ := pk.ValueOf(ctx, reflect.ValueOf(obj))
+	return fmt.Sprint(key)
+}
+
+// fieldsOf returns the JSON encoded fields of obj.
+func fieldsOf(obj any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diff removes the unchanged fields from c, and tells whether some remain.
+func diff(c *Changes) bool {
+	for name, before := range c.Before {
+		if after, ok := c.After[name]; ok && bytes.Equal(before, after) {
+			delete(c.Before, name)
+			delete(c.After, name)
+		}
+	}
+	return len(c.Before) > 0 || len(c.After) > 0
+}
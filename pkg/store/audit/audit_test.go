@@ -0,0 +1,103 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/audit"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type User struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func newDB(t *testing.T) *gorm.DB {
+	return dbtest.NewSQLite(t, nil, &User{}, &audit.Record{})
+}
+
+// writer 记录写入的 Kafka 消息.
+type writer struct {
+	msgs []kafka.Message
+}
+
+func (w *writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func TestHook_TableSink(t *testing.T) {
+	db := newDB(t)
+	users := store.NewStore[User](store.NewTxManager(db), nil,
+		store.WithHooks[User](audit.NewHook[User](audit.NewTableSink(db))))
+	ctx := audit.WithActor(context.Background(), "admin")
+
+	alice := &User{Name: "alice", Email: "alice@example.com"}
+	require.NoError(t, users.Create(ctx, alice))
+	require.NoError(t, users.UpdateFields(ctx, &User{ID: alice.ID, Name: "alicia"}, store.FieldPaths{"name"}))
+	// 没有变化的更新不会被记录
+	require.NoError(t, users.UpdateFields(ctx, &User{ID: alice.ID, Name: "alicia"}, store.FieldPaths{"name"}))
+	require.NoError(t, users.Delete(context.Background(), where.F("id", alice.ID)))
+
+	var records []*audit.Record
+	require.NoError(t, db.Order("id").Find(&records).Error)
+	require.Len(t, records, 3)
+	for _, record := range records {
+		assert.Equal(t, "users", record.Entity)
+		assert.Equal(t, strconv.FormatInt(alice.ID, 10), record.EntityID)
+	}
+	assert.Equal(t, "admin", records[0].Actor)
+	assert.Equal(t, "create", records[0].Operation)
+	assert.JSONEq(t, `{"after":{"id":1,"name":"alice","email":"alice@example.com"}}`, records[0].Changes)
+
+	// 更新只记录变化的字段
+	assert.Equal(t, "UpdateFields", records[1].Method)
+	assert.JSONEq(t, `{"before":{"name":"alice"},"after":{"name":"alicia"}}`, records[1].Changes)
+
+	assert.Empty(t, records[2].Actor)
+	assert.Equal(t, "delete", records[2].Operation)
+	assert.JSONEq(t, `{"before":{"id":1,"name":"alicia","email":"alice@example.com"}}`, records[2].Changes)
+}
+
+func TestHook_KafkaSink(t *testing.T) {
+	db := newDB(t)
+	w := &writer{}
+	users := store.NewStore[User](store.NewTxManager(db), nil, store.WithHooks[User](
+		audit.NewHook[User](audit.NewKafkaSink(w), audit.WithEntity("user"), audit.WithActorFunc(func(ctx context.Context) string {
+			return "system"
+		})),
+	))
+	ctx := context.Background()
+
+	_, err := users.CreateInBatches(ctx, []*User{{Name: "alice"}, {Name: "bob"}}, 0)
+	require.NoError(t, err)
+	require.Len(t, w.msgs, 2)
+	assert.Equal(t, "user:2", string(w.msgs[1].Key))
+	var record audit.Record
+	require.NoError(t, json.Unmarshal(w.msgs[1].Value, &record))
+	assert.Equal(t, "system", record.Actor)
+	assert.Equal(t, "CreateInBatches", record.Method)
+
+	// 回滚的变更不会发布
+	errFailed := errors.New("failed")
+	err = store.NewTxManager(db).RunInTx(ctx, func(ctx context.Context) error {
+		if err := users.Create(ctx, &User{Name: "carol"}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	assert.Len(t, w.msgs, 2)
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/log"
+	"github.com/LiangNing7/goutils/pkg/store"
+)
+
+// Sink writes audit records.
+type Sink interface {
+	// Write writes the records. It is called in the transaction of the
+	// mutation, which is carried by ctx, so that an error rolls it back.
+	Write(ctx context.Context, records []*Record) error
+}
+
+// TableSink is a Sink inserting the records into the audit table, see Record.
+// The records are inserted in the transaction of the mutation, so that they
+// are committed together with it: the table must be in the same database as
+// the audited models.
+type TableSink struct {
+	db *gorm.DB
+}
+
+// Ensure TableSink implements the Sink interface.
+var _ Sink = (*TableSink)(nil)
+
+// NewTableSink creates a new TableSink on db. The audit table can be created
+// with db.AutoMigrate(&audit.Record{}) or a migration.
+func NewTableSink(db *gorm.DB) *TableSink {
+	return &TableSink{db: db}
+}
+
+// Write implements Sink.
+func (s *TableSink) Write(ctx context.Context, records []*Record) error {
+	db, ok := store.TxFromContext(ctx)
+	if !ok {
+		db = s.db.WithContext(ctx)
+	}
+	return db.Create(records).Error
+}
+
+// MessageWriter writes Kafka messages, e.g. the *kafka.Writer returned by
+// options.KafkaOptions.Writer.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// KafkaSink is a Sink publishing the records as JSON messages, keyed by
+// entity and primary key so that the changes of an object stay ordered.
+// The records are published once the transaction of the mutation is
+// committed, so that rolled back changes are not published; publishing
+// errors cannot roll the mutation back anymore and are only logged.
+type KafkaSink struct {
+	writer MessageWriter
+}
+
+// Ensure KafkaSink implements the Sink interface.
+var _ Sink = (*KafkaSink)(nil)
+
+// NewKafkaSink creates a new KafkaSink publishing with writer.
+func NewKafkaSink(writer MessageWriter) *KafkaSink {
+	return &KafkaSink{writer: writer}
+}
+
+// Write implements Sink.
+func (s *KafkaSink) Write(ctx context.Context, records []*Record) error {
+	msgs := make([]kafka.Message, 0, len(records))
+	for _, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, kafka.Message{Key: []byte(record.Entity + ":" + record.EntityID), Value: value})
+	}
+
+	store.AfterCommit(ctx, func(ctx context.Context) {
+		if err := s.writer.WriteMessages(ctx, msgs...); err != nil {
+			log.Errorw(err, "Failed to publish audit records", "count", len(msgs))
+		}
+	})
+	return nil
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// defaultBatchSize is the batch size used by CreateInBatches when none is given.
+const defaultBatchSize = 100
+
+// CreateInBatches inserts the objects into the database, batchSize objects per
+// statement, and returns the number of inserted rows. Unless ctx carries a
+// transaction, the batches are inserted in a transaction of their own.
+func (s *Store[T]) CreateInBatches(ctx context.Context, objs []*T, batchSize int) (int64, error) {
+	var n int64
+	err := s.mutate(ctx, mutation[T]{
+		operation: OperationCreate,
+		method:    "CreateInBatches",
+		run: func(ctx context.Context) error {
+			if len(objs) == 0 {
+				return nil
+			}
+			if batchSize <= 0 {
+				batchSize = defaultBatchSize
+			}
+
+			db := s.db(ctx)
+			if err := s.stampTenant(ctx, db, objs...); err != nil {
+				s.logger.Error(ctx, err, "Failed to insert objects into database", "count", len(objs))
+				return err
+			}
+			result := db.CreateInBatches(objs, batchSize)
+			if result.Error != nil {
+				s.logger.Error(ctx, result.Error, "Failed to insert objects into database", "count", len(objs))
+				return result.Error
+			}
+			n = result.RowsAffected
+			return nil
+		},
+		after: objects(objs...),
+	})
+	return n, err
+}
+
+// ErrUpsertUnsupported is returned by Upsert on tenant-aware stores when the
+// database cannot restrict the conflicting rows to the tenant.
+var ErrUpsertUnsupported = errors.New("upsert is not supported by the database of tenant-aware stores")
+
+// Upsert inserts the objects into the database, or updates the existing rows
+// which conflict with them on conflictColumns. Only updateColumns are updated,
+// or all columns if none is given. conflictColumns defaults to the primary key
+// and must be backed by a unique index. It returns the number of affected
+// rows as reported by the database, e.g. MySQL counts updated rows twice.
+// Tenant-aware stores never update the tenant column, and leave the rows of
+// other tenants untouched; this is supported on PostgreSQL, SQLite and MySQL
+// only, ErrUpsertUnsupported is returned on other databases.
+//
+// Upsert does not call the hooks set with WithHooks, since which objects are
+// inserted and which ones are updated is only known to the database, so its
+// changes are not audited by audit.Hook. Use Create and Update instead where
+// the changes must be audited.
+func (s *Store[T]) Upsert(ctx context.Context, objs []*T, conflictColumns, updateColumns []string) (int64, error) {
+	if len(objs) == 0 {
+		return 0, nil
+	}
+
+	db := s.db(ctx)
+	if err := s.stampTenant(ctx, db, objs...); err != nil {
+		s.logger.Error(ctx, err, "Failed to upsert objects into database", "count", len(objs))
+		return 0, err
+	}
+	onConflict, err := s.onConflict(ctx, db, conflictColumns, updateColumns)
+	if err != nil {
+		s.logger.Error(ctx, err, "Failed to upsert objects into database", "count", len(objs))
+		return 0, err
+	}
+
+	result := db.Clauses(onConflict).Create(objs)
+	if result.Error != nil {
+		s.logger.Error(ctx, result.Error, "Failed to upsert objects into database", "count", len(objs))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// onConflict builds the conflict clause of Upsert. The columns to update are
+// listed explicitly on tenant-aware stores, so that the tenant column is left
+// out, and the update is restricted to the rows of the tenant: with a WHERE
+// condition where the database supports it, or else by assigning the columns
+// their own value on the rows of other tenants.
+func (s *Store[T]) onConflict(ctx context.Context, db *gorm.DB, conflictColumns, updateColumns []string) (clause.OnConflict, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return clause.OnConflict{}, err
+	}
+	if len(conflictColumns) == 0 {
+		conflictColumns = stmt.Schema.PrimaryFieldDBNames
+	}
+
+	onConflict := clause.OnConflict{}
+	for _, column := range conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	if s.tenant == nil {
+		if len(updateColumns) == 0 {
+			onConflict.UpdateAll = true
+		} else {
+			onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+		}
+		return onConflict, nil
+	}
+
+	if len(updateColumns) == 0 {
+		updateColumns = upsertColumns(stmt.Schema, conflictColumns)
+	}
+	columns := make([]string, 0, len(updateColumns))
+	for _, column := range updateColumns {
+		if column != s.tenant.Key {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		onConflict.DoNothing = true
+		return onConflict, nil
+	}
+
+	tenant := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: s.tenant.Key}, Value: s.tenant.ValueFunc(ctx)}
+	switch db.Dialector.Name() {
+	case "postgres", "sqlite":
+		onConflict.DoUpdates = clause.AssignmentColumns(columns)
+		onConflict.Where = clause.Where{Exprs: []clause.Expression{tenant}}
+	case "mysql":
+		// MySQL ignores the WHERE condition of ON DUPLICATE KEY UPDATE. The
+		// tenant column is never assigned, so that the condition holds for
+		// all the assignments of a row.
+		for _, column := range columns {
+			onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+				Column: clause.Column{Name: column},
+				Value: clause.Expr{SQL: "IF(?, VALUES(?), ?)", Vars: []any{
+					tenant, clause.Column{Name: column}, clause.Column{Name: column},
+				}},
+			})
+		}
+	default:
+		return clause.OnConflict{}, ErrUpsertUnsupported
+	}
+	return onConflict, nil
+}
+
+// upsertColumns returns the columns which Upsert updates when none is given,
+// the same as GORM's UpdateAll: all columns but the primary key, the conflict
+// columns, and the ones set on creation only.
+func upsertColumns(s *schema.Schema, conflictColumns []string) []string {
+	var columns []string
+	for _, name := range s.DBNames {
+		field := s.FieldsByDBName[name]
+		if field.PrimaryKey || slices.Contains(conflictColumns, name) || !field.Creatable || !field.Updatable ||
+			field.AutoCreateTime != 0 || (field.HasDefaultValue && field.DefaultValueInterface == nil) {
+			continue
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+// BatchUpdate sets the given columns of all objects matching the provided
+// where options, and returns the number of updated rows. The tenant column of
+// tenant-aware stores is never updated.
+func (s *Store[T]) BatchUpdate(ctx context.Context, opts *where.Options, columns map[string]any) (int64, error) {
+	var n int64
+	err := s.mutate(ctx, mutation[T]{
+		operation: OperationUpdate,
+		method:    "BatchUpdate",
+		before:    s.selected(opts, s.activeScope),
+		run: func(ctx context.Context) error {
+			columns := s.unscopedColumns(columns)
+			result := s.active(s.db(ctx, opts)).Model(new(T)).Updates(columns)
+			if result.Error != nil {
+				s.logger.Error(ctx, result.Error, "Failed to update objects in database", "conditions", opts, "columns", columns)
+				return result.Error
+			}
+			n = result.RowsAffected
+			return nil
+		},
+		after: s.reload,
+	})
+	return n, err
+}
+
+// BatchDelete removes all objects matching the provided where options, like
+// Delete, and returns the number of deleted rows.
+func (s *Store[T]) BatchDelete(ctx context.Context, opts *where.Options) (int64, error) {
+	var n int64
+	err := s.mutate(ctx, mutation[T]{
+		operation: OperationDelete,
+		method:    "BatchDelete",
+		before:    s.selected(opts, s.activeScope),
+		run: func(ctx context.Context) error {
+			var result *gorm.DB
+			if s.softDeleteFlag != nil {
+				result = s.active(s.db(ctx, opts)).Model(new(T)).Update(s.softDeleteFlag.column, s.softDeleteFlag.deleted)
+			} else {
+				result = s.db(ctx, opts).Delete(new(T))
+			}
+			if result.Error != nil {
+				s.logger.Error(ctx, result.Error, "Failed to delete objects from database", "conditions", opts)
+				return result.Error
+			}
+			n = result.RowsAffected
+			return nil
+		},
+	})
+	return n, err
+}
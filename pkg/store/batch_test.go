@@ -0,0 +1,76 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type Setting struct {
+	ID    int64
+	Key   string `gorm:"size:64;uniqueIndex"`
+	Value string
+	Note  string
+}
+
+func TestStore_Batch(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Setting{}))
+	txm := store.NewTxManager(db)
+	settings := store.NewStore[Setting](txm, nil)
+
+	n, err := settings.CreateInBatches(ctx, []*Setting{{Key: "a", Value: "1"}, {Key: "b", Value: "1"}, {Key: "c", Value: "1"}}, 2)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, n)
+
+	// 按唯一键冲突时只更新 value 列
+	n, err = settings.Upsert(ctx, []*Setting{{Key: "a", Value: "2", Note: "x"}, {Key: "d", Value: "2", Note: "x"}}, []string{"key"}, []string{"value"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	a, err := settings.Get(ctx, where.F("key", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", a.Value)
+	assert.Empty(t, a.Note)
+
+	// 默认按主键冲突并更新所有列
+	a.Note = "y"
+	_, err = settings.Upsert(ctx, []*Setting{a}, nil, nil)
+	require.NoError(t, err)
+	a, err = settings.Get(ctx, where.F("key", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "y", a.Note)
+
+	n, err = settings.BatchUpdate(ctx, where.F("value", "1"), map[string]any{"value": "3", "note": "z"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	n, err = settings.BatchDelete(ctx, where.F("value", "3"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	// 在调用方的事务中执行，随事务一起回滚
+	errAbort := errors.New("abort")
+	err = txm.RunInTx(ctx, func(ctx context.Context) error {
+		n, err := settings.CreateInBatches(ctx, []*Setting{{Key: "e"}, {Key: "f"}}, 1)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, n)
+
+		n, err = settings.BatchDelete(ctx, where.NewWhere().Q("1 = 1"))
+		require.NoError(t, err)
+		assert.EqualValues(t, 4, n)
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+
+	count, _, err := settings.List(ctx, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+}
@@ -0,0 +1,85 @@
+// Package cache provides the caches used by store.CachedStore: Redis, shared
+// by the instances of a service, and an in-process LRU.
+package cache // import "github.com/LiangNing7/goutils/pkg/store/cache"
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// ErrMiss is returned by Cache.Get when the key is not in the cache.
+var ErrMiss = errors.New("cache miss")
+
+// noExpiration is the TTL of the LRU entries set without TTL.
+const noExpiration = 100 * 365 * 24 * time.Hour
+
+// Cache is a byte cache whose entries expire.
+type Cache interface {
+	// Get returns the value of key, or ErrMiss if it is not in the cache.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set sets the value of key, which expires after ttl. A zero ttl means no expiration.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Redis is a Cache storing its entries in Redis.
+type Redis struct {
+	client redis.UniversalClient
+}
+
+// Ensure Redis implements the Cache interface.
+var _ Cache = (*Redis)(nil)
+
+// NewRedis creates a new Redis cache with the given client, e.g. created by
+// db.NewRedis.
+func NewRedis(client redis.UniversalClient) *Redis {
+	return &Redis{client: client}
+}
+
+// Get implements Cache.
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+// Set implements Cache.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+// LRU is an in-process Cache evicting the least recently used entries.
+type LRU struct {
+	cache *cache.LRUExpireCache
+}
+
+// Ensure LRU implements the Cache interface.
+var _ Cache = (*LRU)(nil)
+
+// NewLRU creates a new LRU cache holding at most size entries.
+func NewLRU(size int) *LRU {
+	return &LRU{cache: cache.NewLRUExpireCache(size)}
+}
+
+// Get implements Cache.
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, error) {
+	value, ok := c.cache.Get(key)
+	if !ok {
+		return nil, ErrMiss
+	}
+	return value.([]byte), nil
+}
+
+// Set implements Cache.
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = noExpiration
+	}
+	c.cache.Add(key, value, ttl)
+	return nil
+}
@@ -0,0 +1,42 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiangNing7/goutils/pkg/store/cache"
+)
+
+func TestCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	caches := map[string]cache.Cache{
+		"lru":   cache.NewLRU(2),
+		"redis": cache.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+
+	ctx := context.Background()
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.Get(ctx, "k")
+			require.ErrorIs(t, err, cache.ErrMiss)
+
+			require.NoError(t, c.Set(ctx, "k", []byte("v"), 0))
+			value, err := c.Get(ctx, "k")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("v"), value)
+
+			// 过期的条目不再返回
+			require.NoError(t, c.Set(ctx, "expired", []byte("v"), time.Millisecond))
+			time.Sleep(10 * time.Millisecond)
+			mr.FastForward(time.Second)
+			_, err = c.Get(ctx, "expired")
+			require.ErrorIs(t, err, cache.ErrMiss)
+		})
+	}
+}
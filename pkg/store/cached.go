@@ -0,0 +1,260 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/store/cache"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+const (
+	// DefaultCacheTTL is the time objects are cached by a CachedStore by default.
+	DefaultCacheTTL = 5 * time.Minute
+	// DefaultNegativeCacheTTL is the time missing objects are cached by a CachedStore by default.
+	DefaultNegativeCacheTTL = 30 * time.Second
+)
+
+// notFound is the cached value of the objects which do not exist.
+var notFound = []byte("null")
+
+// CacheOption defines a function type for configuring the CachedStore.
+type CacheOption[T any] func(*CachedStore[T])
+
+// CachedStore is a Store whose Get caches the objects, or the fact that they
+// do not exist. The cache key is derived from the query built for the where
+// options, including the tenant of tenant-aware stores, and all cached
+// objects are invalidated by the write methods of the CachedStore. Reads in
+// a transaction bypass the cache, and writes in a transaction invalidate it
+// once the transaction is committed, see AfterCommit.
+//
+// The cache is shared with the other CachedStores of the same model and
+// prefix, e.g. by the instances of a service using the same Redis, but writes
+// made by other means are only seen once the cached objects expire.
+type CachedStore[T any] struct {
+	*Store[T]
+	cache       cache.Cache
+	prefix      string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	group       singleflight.Group
+}
+
+// WithCacheTTL returns a CacheOption function that sets the time objects are
+// cached, DefaultCacheTTL by default.
+func WithCacheTTL[T any](ttl time.Duration) CacheOption[T] {
+	return func(s *CachedStore[T]) {
+		s.ttl = ttl
+	}
+}
+
+// WithNegativeCacheTTL returns a CacheOption function that sets the time
+// missing objects are cached, DefaultNegativeCacheTTL by default. A zero ttl
+// disables negative caching.
+func WithNegativeCacheTTL[T any](ttl time.Duration) CacheOption[T] {
+	return func(s *CachedStore[T]) {
+		s.negativeTTL = ttl
+	}
+}
+
+// WithCachePrefix returns a CacheOption function that sets the prefix of the
+// cache keys, "store:" followed by the name of the model type by default.
+func WithCachePrefix[T any](prefix string) CacheOption[T] {
+	return func(s *CachedStore[T]) {
+		s.prefix = prefix
+	}
+}
+
+// NewCachedStore creates a new CachedStore caching the objects of the given
+// Store in the given cache.
+func NewCachedStore[T any](store *Store[T], cache cache.Cache, opts ...CacheOption[T]) *CachedStore[T] {
+	s := &CachedStore[T]{
+		Store:       store,
+		cache:       cache,
+		prefix:      "store:" + reflect.TypeFor[T]().String(),
+		ttl:         DefaultCacheTTL,
+		negativeTTL: DefaultNegativeCacheTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Get retrieves a single object from the cache or, on a miss, from the
+// database based on the provided where options. Misses are read from the
+// primary, so that a lagging replica cannot cache stale objects until they
+// expire. Concurrent misses of the same object are collapsed into a single
+// query, which is not cancelled with the context of the caller that started
+// it, since the other callers wait for it as well. Failures of the cache are
+// logged and the object is then retrieved from the database.
+func (s *CachedStore[T]) Get(ctx context.Context, opts *where.Options) (*T, error) {
+	if _, ok := TxFromContext(ctx); ok {
+		return s.Store.Get(ctx, opts)
+	}
+
+	db := s.active(s.readDB(WithPrimary(ctx), "Get", opts))
+	dryRun := db.Session(&gorm.Session{DryRun: true}).First(new(T))
+	if err := dryRun.Error; err != nil {
+		s.logger.Error(ctx, err, "Failed to retrieve object from database", "conditions", opts)
+		return nil, err
+	}
+	generation, err := s.generation(ctx)
+	if err != nil {
+		s.logger.Error(ctx, err, "Failed to get cache generation", "prefix", s.prefix)
+		return s.first(ctx, db, opts)
+	}
+	query := sha256.Sum256([]byte(db.Dialector.Explain(dryRun.Statement.SQL.String(), dryRun.Statement.Vars...)))
+	key := fmt.Sprintf("%s:%s:%x", s.prefix, generation, query)
+
+	value, err, _ := s.group.Do(key, func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		return s.load(ctx, key, db.WithContext(ctx), opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(value.([]byte), notFound) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var obj T
+	if err := json.Unmarshal(value.([]byte), &obj); err != nil {
+		s.logger.Error(ctx, err, "Failed to decode cached object", "key", key)
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// load returns the cached value of key or, on a miss, retrieves the object
+// selected by db and caches it.
+func (s *CachedStore[T]) load(ctx context.Context, key string, db *gorm.DB, opts *where.Options) ([]byte, error) {
+	value, err := s.cache.Get(ctx, key)
+	if err == nil {
+		return value, nil
+	}
+	if !errors.Is(err, cache.ErrMiss) {
+		s.logger.Error(ctx, err, "Failed to get object from cache", "key", key)
+	}
+
+	ttl := s.ttl
+	obj, err := s.first(ctx, db, opts)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && s.negativeTTL > 0:
+		value, ttl = notFound, s.negativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		if value, err = json.Marshal(obj); err != nil {
+			s.logger.Error(ctx, err, "Failed to encode object", "object", obj)
+			return nil, err
+		}
+	}
+
+	if err := s.cache.Set(ctx, key, value, ttl); err != nil {
+		s.logger.Error(ctx, err, "Failed to set object in cache", "key", key)
+	}
+	return value, nil
+}
+
+// generation returns the generation of the cache, which is part of the keys
+// of the cached objects so that changing it invalidates all of them.
+func (s *CachedStore[T]) generation(ctx context.Context) (string, error) {
+	generation, err := s.cache.Get(ctx, s.prefix+":generation")
+	if errors.Is(err, cache.ErrMiss) {
+		// Start a new generation rather than reusing the keys of an evicted one
+		return s.newGeneration(ctx)
+	}
+	return string(generation), err
+}
+
+// newGeneration changes the generation of the cache.
+func (s *CachedStore[T]) newGeneration(ctx context.Context) (string, error) {
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(rand.Uint64(), 36)
+	return generation, s.cache.Set(ctx, s.prefix+":generation", []byte(generation), 0)
+}
+
+// invalidate invalidates the cached objects if the write whose error is err
+// succeeded, once the transaction carried by ctx, if any, is committed.
+func (s *CachedStore[T]) invalidate(ctx context.Context, err error) error {
+	if err != nil {
+		return err
+	}
+
+	AfterCommit(ctx, func(ctx context.Context) {
+		if _, err := s.newGeneration(ctx); err != nil {
+			s.logger.Error(ctx, err, "Failed to invalidate cache", "prefix", s.prefix)
+		}
+	})
+	return nil
+}
+
+// Create inserts a new object into the database, see Store.Create.
+func (s *CachedStore[T]) Create(ctx context.Context, obj *T) error {
+	return s.invalidate(ctx, s.Store.Create(ctx, obj))
+}
+
+// Update modifies an existing object in the database, see Store.Update.
+func (s *CachedStore[T]) Update(ctx context.Context, obj *T) error {
+	return s.invalidate(ctx, s.Store.Update(ctx, obj))
+}
+
+// UpdateFields updates the fields of obj listed in mask, see Store.UpdateFields.
+func (s *CachedStore[T]) UpdateFields(ctx context.Context, obj *T, mask FieldMask) error {
+	return s.invalidate(ctx, s.Store.UpdateFields(ctx, obj, mask))
+}
+
+// Delete removes objects from the database, see Store.Delete.
+func (s *CachedStore[T]) Delete(ctx context.Context, opts *where.Options) error {
+	return s.invalidate(ctx, s.Store.Delete(ctx, opts))
+}
+
+// SoftDelete marks objects as deleted, see Store.SoftDelete.
+func (s *CachedStore[T]) SoftDelete(ctx context.Context, opts *where.Options) error {
+	return s.invalidate(ctx, s.Store.SoftDelete(ctx, opts))
+}
+
+// Restore undeletes soft-deleted objects, see Store.Restore.
+func (s *CachedStore[T]) Restore(ctx context.Context, opts *where.Options) error {
+	return s.invalidate(ctx, s.Store.Restore(ctx, opts))
+}
+
+// Purge permanently removes soft-deleted objects, see Store.Purge.
+func (s *CachedStore[T]) Purge(ctx context.Context, opts *where.Options) error {
+	return s.invalidate(ctx, s.Store.Purge(ctx, opts))
+}
+
+// CreateInBatches inserts objects into the database, see Store.CreateInBatches.
+func (s *CachedStore[T]) CreateInBatches(ctx context.Context, objs []*T, batchSize int) (int64, error) {
+	n, err := s.Store.CreateInBatches(ctx, objs, batchSize)
+	return n, s.invalidate(ctx, err)
+}
+
+// Upsert inserts or updates objects, see Store.Upsert.
+func (s *CachedStore[T]) Upsert(ctx context.Context, objs []*T, conflictColumns, updateColumns []string) (int64, error) {
+	n, err := s.Store.Upsert(ctx, objs, conflictColumns, updateColumns)
+	return n, s.invalidate(ctx, err)
+}
+
+// BatchUpdate sets columns of objects, see Store.BatchUpdate.
+func (s *CachedStore[T]) BatchUpdate(ctx context.Context, opts *where.Options, columns map[string]any) (int64, error) {
+	n, err := s.Store.BatchUpdate(ctx, opts, columns)
+	return n, s.invalidate(ctx, err)
+}
+
+// BatchDelete removes objects, see Store.BatchDelete.
+func (s *CachedStore[T]) BatchDelete(ctx context.Context, opts *where.Options) (int64, error) {
+	n, err := s.Store.BatchDelete(ctx, opts)
+	return n, s.invalidate(ctx, err)
+}
@@ -0,0 +1,164 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/cache"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// countQueries 统计 db 执行的查询次数, 每次查询耗时至少 delay.
+func countQueries(t *testing.T, db *gorm.DB, delay time.Duration) *atomic.Int64 {
+	var n atomic.Int64
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:count", func(db *gorm.DB) {
+		if !db.DryRun {
+			n.Add(1)
+			time.Sleep(delay)
+		}
+	}))
+	return &n
+}
+
+func TestCachedStore_Get(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	queries := countQueries(t, db, 0)
+	users := store.NewCachedStore(store.NewStore[User](store.NewTxManager(db), nil), cache.NewLRU(100))
+	require.NoError(t, users.Create(ctx, &User{ID: 1, Name: "alice"}))
+
+	// 第二次读取命中缓存
+	for range 2 {
+		user, err := users.Get(ctx, where.F("id", 1))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", user.Name)
+	}
+	assert.EqualValues(t, 1, queries.Load())
+
+	// 不存在的记录同样被缓存
+	for range 2 {
+		_, err := users.Get(ctx, where.F("id", 2))
+		require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	}
+	assert.EqualValues(t, 2, queries.Load())
+
+	// 写入后缓存失效
+	require.NoError(t, users.Create(ctx, &User{ID: 2, Name: "bob"}))
+	user, err := users.Get(ctx, where.F("id", 2))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.Name)
+
+	require.NoError(t, users.Update(ctx, &User{ID: 1, Name: "alice2"}))
+	user, err = users.Get(ctx, where.F("id", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "alice2", user.Name)
+
+	require.NoError(t, users.Delete(ctx, where.F("id", 1)))
+	_, err = users.Get(ctx, where.F("id", 1))
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestCachedStore_Tx(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	queries := countQueries(t, db, 0)
+	txm := store.NewTxManager(db)
+	users := store.NewCachedStore(store.NewStore[User](txm, nil), cache.NewLRU(100))
+	require.NoError(t, users.Create(ctx, &User{ID: 1, Name: "alice"}))
+	_, err := users.Get(ctx, where.F("id", 1))
+	require.NoError(t, err)
+
+	// 回滚的修改不会使缓存失效, 事务中的读取不使用缓存
+	errRollback := errors.New("rollback")
+	err = txm.RunInTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, users.Update(ctx, &User{ID: 1, Name: "uncommitted"}))
+		user, err := users.Get(ctx, where.F("id", 1))
+		require.NoError(t, err)
+		assert.Equal(t, "uncommitted", user.Name)
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	n := queries.Load()
+	user, err := users.Get(ctx, where.F("id", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+	assert.Equal(t, n, queries.Load())
+
+	// 提交后缓存失效
+	require.NoError(t, txm.RunInTx(ctx, func(ctx context.Context) error {
+		return users.Update(ctx, &User{ID: 1, Name: "committed"})
+	}))
+	user, err = users.Get(ctx, where.F("id", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "committed", user.Name)
+}
+
+func TestCachedStore_Singleflight(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	require.NoError(t, db.Create(&User{ID: 1, Name: "alice"}).Error)
+	queries := countQueries(t, db, 100*time.Millisecond)
+	users := store.NewCachedStore(store.NewStore[User](store.NewTxManager(db), nil), cache.NewLRU(100))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := users.Get(ctx, where.F("id", 1))
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", user.Name)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, queries.Load())
+}
+
+func TestCachedStore_Primary(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := newDB(t), newDB(t)
+	require.NoError(t, replica.Create(&User{ID: 1, Name: "stale"}).Error)
+	cluster, err := db.NewCluster(primary, []*gorm.DB{replica}, &db.RoundRobinPolicy{})
+	require.NoError(t, err)
+	txm := store.NewTxManager(cluster.Primary(), store.WithReplicas(cluster))
+	users := store.NewCachedStore(store.NewStore[User](txm, nil), cache.NewLRU(100))
+
+	// 缓存未命中时读取主库, 不会缓存从库中过期的记录
+	require.NoError(t, users.Create(ctx, &User{ID: 1, Name: "alice"}))
+	user, err := users.Get(ctx, where.F("id", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+}
+
+func TestCachedStore_SingleflightCancel(t *testing.T) {
+	db := newDB(t)
+	require.NoError(t, db.Create(&User{ID: 1, Name: "alice"}).Error)
+	queries := countQueries(t, db, 100*time.Millisecond)
+	users := store.NewCachedStore(store.NewStore[User](store.NewTxManager(db), nil), cache.NewLRU(100))
+
+	// 发起查询的调用方取消后, 等待同一查询的其他调用方仍然得到结果
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _ = users.Get(ctx, where.F("id", 1))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	user, err := users.Get(context.Background(), where.F("id", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+	assert.EqualValues(t, 1, queries.Load())
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/util/reflect"
+)
+
+// FieldMask is a set of field paths to update. It is implemented by
+// FieldPaths and by protobuf's *fieldmaskpb.FieldMask.
+type FieldMask interface {
+	GetPaths() []string
+}
+
+// FieldPaths is a FieldMask listing field paths.
+type FieldPaths []string
+
+// GetPaths implements FieldMask.
+func (p FieldPaths) GetPaths() []string {
+	return p
+}
+
+// UpdateFields updates only the fields of obj listed in mask, leaving the
+// other columns untouched. Paths are field names, JSON names or snake_case
+// names as used by protobuf field masks. Fields of embedded structs are
+// referred to with dotted paths, e.g. "profile.nickname". Columns are named
+// after the column tag of the field or, by default, by the GORM naming
+// strategy. Unknown fields are rejected with errorsx.ErrInvalidArgument. The
+// tenant column of tenant-aware stores is never updated. obj must have a
+// primary key, and gorm.ErrRecordNotFound is returned if it does not exist in
+// the scope of the store.
+func (s *Store[T]) UpdateFields(ctx context.Context, obj *T, mask FieldMask) error {
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationUpdate,
+		method:    "UpdateFields",
+		before:    s.current(obj),
+		run: func(ctx context.Context) error {
+			db := s.db(ctx)
+			if err := requirePrimaryKey(ctx, db, obj); err != nil {
+				return err
+			}
+
+			var paths []string
+			if mask != nil {
+				paths = mask.GetPaths()
+			}
+			if len(paths) == 0 {
+				return errorsx.New(errorsx.ErrInvalidArgument.Code, errorsx.ErrInvalidArgument.Reason, "Field mask is empty.")
+			}
+
+			columns, err := reflect.ToGormDBMapWithNamer(obj, paths, func(name string) string {
+				return db.NamingStrategy.ColumnName("", name)
+			})
+			if err != nil {
+				return errorsx.New(errorsx.ErrInvalidArgument.Code, errorsx.ErrInvalidArgument.Reason, "Invalid field mask: %v", err)
+			}
+			columns = s.unscopedColumns(columns)
+			if len(columns) == 0 {
+				return errorsx.New(errorsx.ErrInvalidArgument.Code, errorsx.ErrInvalidArgument.Reason, "Field mask only lists the tenant.")
+			}
+
+			if s.optimisticLock {
+				err = s.updateVersioned(ctx, db, obj, columns)
+			} else {
+				result := db.Model(obj).Updates(columns)
+				if err = result.Error; err == nil {
+					err = s.requireUpdated(ctx, result, obj)
+				}
+			}
+			if err != nil {
+				s.logger.Error(ctx, err, "Failed to update object fields in database", "object", obj, "paths", paths)
+				return err
+			}
+			return nil
+		},
+		after: s.reloaded(obj),
+	})
+}
@@ -0,0 +1,111 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type Address struct {
+	City   string
+	Street string
+}
+
+type Account struct {
+	ID          int64
+	DisplayName string
+	Email       string  `gorm:"column:mail"`
+	Address     Address `gorm:"embedded;embeddedPrefix:addr_"`
+	Version     int64   `store:"version"`
+}
+
+func TestStore_UpdateFields(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Account{}))
+	accounts := store.NewStore[Account](store.NewTxManager(db), nil)
+
+	account := &Account{DisplayName: "alice", Email: "alice@example.com", Address: Address{City: "x", Street: "y"}}
+	require.NoError(t, accounts.Create(ctx, account))
+
+	// 只更新掩码中的字段，其他字段保持不变
+	update := &Account{ID: account.ID, DisplayName: "Alice", Email: "ignored", Address: Address{City: "z"}}
+	require.NoError(t, accounts.UpdateFields(ctx, update, &fieldmaskpb.FieldMask{Paths: []string{"display_name", "address.city"}}))
+
+	got, err := accounts.Get(ctx, where.F("id", account.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", got.DisplayName)
+	assert.Equal(t, "alice@example.com", got.Email)
+	assert.Equal(t, Address{City: "z", Street: "y"}, got.Address)
+
+	require.NoError(t, accounts.UpdateFields(ctx, &Account{ID: account.ID, Email: "a@example.com"}, store.FieldPaths{"Email"}))
+	got, err = accounts.Get(ctx, where.F("id", account.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com", got.Email)
+
+	// 未知字段和空掩码被拒绝
+	err = accounts.UpdateFields(ctx, update, store.FieldPaths{"password"})
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+	err = accounts.UpdateFields(ctx, update, store.FieldPaths{})
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+
+	// 没有主键或记录不存在时不更新任何记录
+	err = accounts.UpdateFields(ctx, &Account{DisplayName: "bob"}, store.FieldPaths{"display_name"})
+	assert.ErrorIs(t, err, gorm.ErrPrimaryKeyRequired)
+	err = accounts.UpdateFields(ctx, &Account{ID: account.ID + 1, DisplayName: "bob"}, store.FieldPaths{"display_name"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	count, _, err := accounts.List(ctx, where.F("display_name", "bob"))
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestStore_UpdateFields_OptimisticLock(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Account{}))
+	accounts := store.NewStore[Account](store.NewTxManager(db), nil, store.WithOptimisticLock[Account]())
+
+	account := &Account{DisplayName: "alice"}
+	require.NoError(t, accounts.Create(ctx, account))
+
+	stale := *account
+	account.DisplayName = "Alice"
+	require.NoError(t, accounts.UpdateFields(ctx, account, store.FieldPaths{"display_name"}))
+	assert.EqualValues(t, 1, account.Version)
+
+	stale.Email = "alice@example.com"
+	err := accounts.UpdateFields(ctx, &stale, store.FieldPaths{"email"})
+	assert.True(t, store.IsConflict(err))
+}
+
+// changedRowsOnly 让更新只报告值发生变化的行数, 模拟未设置 clientFoundRows 的 MySQL:
+// 值没有变化时影响行数为 0.
+func changedRowsOnly(t *testing.T, db *gorm.DB) {
+	require.NoError(t, db.Callback().Update().After("gorm:update").Register("test:changed_rows", func(db *gorm.DB) {
+		db.RowsAffected = 0
+	}))
+}
+
+func TestStore_UpdateFields_Unchanged(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Account{}))
+	changedRowsOnly(t, db)
+	accounts := store.NewStore[Account](store.NewTxManager(db), nil)
+
+	account := &Account{DisplayName: "alice"}
+	require.NoError(t, accounts.Create(ctx, account))
+
+	// 值没有变化的更新不是记录不存在
+	require.NoError(t, accounts.UpdateFields(ctx, &Account{ID: account.ID, DisplayName: "alice"}, store.FieldPaths{"display_name"}))
+	err := accounts.UpdateFields(ctx, &Account{ID: account.ID + 1, DisplayName: "alice"}, store.FieldPaths{"display_name"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,3 @@
+// Package filter parses filter expressions of list APIs, in the style of
+// AIP-160, and compiles them into GORM clauses for where.Options.
+package filter // import "github.com/LiangNing7/goutils/pkg/store/filter"
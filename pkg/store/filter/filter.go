@@ -0,0 +1,382 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// maxDepth 定义了表达式允许的最大嵌套深度.
+const maxDepth = 32
+
+// errUnterminated 表示字符串缺少结束引号.
+var errUnterminated = errors.New("unterminated string")
+
+// ErrAllowlistRequired 表示创建 Parser 时没有通过 WithAllowlist 指定允许过滤的字段.
+var ErrAllowlistRequired = errors.New("filter allowlist is required")
+
+// timeLayouts 定义了时间类型字段支持的格式.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Option 定义了一个函数类型，用于配置 Parser.
+type Option func(*Parser)
+
+// WithAllowlist 设置允许过滤的字段，可以使用字段名、列名或 json 标签名，必须设置.
+// 同一字段的其他名称也可以在表达式中使用.
+func WithAllowlist(fields ...string) Option {
+	return func(p *Parser) {
+		p.allowlist = fields
+	}
+}
+
+// WithNamingStrategy 设置解析模型时使用的命名策略，应与 gorm.Config 中的保持一致.
+func WithNamingStrategy(namer schema.Namer) Option {
+	return func(p *Parser) {
+		p.namer = namer
+	}
+}
+
+// Parser 解析针对某个模型的过滤表达式，语法参考 AIP-160：
+//
+//	status in (active, pending) and created_at > 2025-01-01
+//	not (name like "a%" or age <= 18) and deleted_at = null
+//
+// 支持 =、!=、<、<=、>、>= 比较，in、like，以及 and、or、not 和括号嵌套，关键字不区分大小写.
+// 字段可以使用模型的字段名、列名或 json 标签名，值按字段的类型转换，
+// 与 null 比较时生成 IS NULL 或 IS NOT NULL 条件.
+type Parser struct {
+	namer     schema.Namer
+	allowlist []string
+	fields    map[string]*schema.Field
+	allowed   map[*schema.Field]bool
+}
+
+// NewParser 根据模型创建一个 Parser. 只有白名单中的字段可以过滤，
+// 未设置白名单时返回 ErrAllowlistRequired，白名单中有模型不存在的字段时也返回错误.
+func NewParser(model any, opts ...Option) (*Parser, error) {
+	p := &Parser{namer: schema.NamingStrategy{}}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if len(p.allowlist) == 0 {
+		return nil, ErrAllowlistRequired
+	}
+
+	s, err := schema.Parse(model, &sync.Map{}, p.namer)
+	if err != nil {
+		return nil, err
+	}
+
+	p.fields = make(map[string]*schema.Field)
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		p.fields[field.DBName] = field
+		p.fields[field.Name] = field
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+			p.fields[name] = field
+		}
+	}
+
+	p.allowed = make(map[*schema.Field]bool, len(p.allowlist))
+	for _, name := range p.allowlist {
+		field, ok := p.fields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field %q in allowlist", name)
+		}
+		p.allowed[field] = true
+	}
+	return p, nil
+}
+
+// Parse 解析过滤表达式，返回对应的 GORM 子句. 表达式为空时返回 nil.
+// 表达式无效时返回 errorsx.ErrInvalidArgument，其元数据中包含出错的位置.
+func (p *Parser) Parse(expr string) (clause.Expression, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	if tokens[0].kind == tokenEOF {
+		return nil, nil
+	}
+
+	state := &parser{Parser: p, tokens: tokens}
+	cond, err := state.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := state.peek(); tok.kind != tokenEOF {
+		return nil, syntaxError(tok.pos, "unexpected %q", tok.text)
+	}
+	return cond, nil
+}
+
+// Where 解析过滤表达式，返回将其添加到 where.Options 中的 Option.
+func (p *Parser) Where(expr string) (where.Option, error) {
+	cond, err := p.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	if cond == nil {
+		return where.WithClauses(), nil
+	}
+	return where.WithClauses(cond), nil
+}
+
+// parser 保存解析单个表达式时的状态.
+type parser struct {
+	*Parser
+	tokens []token
+	next   int
+}
+
+// peek 返回下一个词法单元.
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// advance 返回下一个词法单元并前进.
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokenEOF {
+		p.next++
+	}
+	return tok
+}
+
+// expect 读取给定类型的词法单元.
+func (p *parser) expect(kind tokenKind, want string) (token, error) {
+	tok := p.advance()
+	if tok.kind != kind {
+		return tok, unexpected(tok, want)
+	}
+	return tok, nil
+}
+
+// parseOr 解析 and 表达式 (or and 表达式)*.
+func (p *parser) parseOr(depth int) (clause.Expression, error) {
+	cond, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	conds := []clause.Expression{cond}
+	for p.peek().is("or") {
+		p.advance()
+		cond, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return clause.Or(conds...), nil
+}
+
+// parseAnd 解析 not 表达式 (and not 表达式)*.
+func (p *parser) parseAnd(depth int) (clause.Expression, error) {
+	cond, err := p.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	conds := []clause.Expression{cond}
+	for p.peek().is("and") {
+		p.advance()
+		cond, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return clause.And(conds...), nil
+}
+
+// parseNot 解析 not* (括号表达式 | 比较).
+func (p *parser) parseNot(depth int) (clause.Expression, error) {
+	if depth > maxDepth {
+		return nil, syntaxError(p.peek().pos, "expression is nested too deeply")
+	}
+
+	if p.peek().is("not") {
+		p.advance()
+		cond, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return clause.Not(cond), nil
+	}
+
+	if p.peek().kind == tokenLParen {
+		p.advance()
+		cond, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return cond, nil
+	}
+
+	return p.parseComparison()
+}
+
+// parseComparison 解析 字段 运算符 值、字段 in (值, ...) 或 字段 like 值.
+func (p *parser) parseComparison() (clause.Expression, error) {
+	tok, err := p.expect(tokenWord, "field")
+	if err != nil {
+		return nil, err
+	}
+	field, err := p.field(tok)
+	if err != nil {
+		return nil, err
+	}
+	column := clause.Column{Name: field.DBName}
+
+	op := p.advance()
+	switch {
+	case op.is("in"):
+		if _, err := p.expect(tokenLParen, "'('"); err != nil {
+			return nil, err
+		}
+		var values []any
+		for {
+			value, err := p.value(field, false)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+
+			tok := p.advance()
+			if tok.kind == tokenRParen {
+				break
+			}
+			if tok.kind != tokenComma {
+				return nil, unexpected(tok, "',' or ')'")
+			}
+		}
+		return clause.IN{Column: column, Values: values}, nil
+
+	case op.is("like"):
+		if field.GORMDataType != schema.String {
+			return nil, syntaxError(op.pos, "like is not supported by field %q", tok.text)
+		}
+		value, err := p.value(field, false)
+		if err != nil {
+			return nil, err
+		}
+		return clause.Like{Column: column, Value: value}, nil
+
+	case op.kind == tokenOperator:
+		value, err := p.value(field, op.text == "=" || op.text == "!=")
+		if err != nil {
+			return nil, err
+		}
+		switch op.text {
+		case "=":
+			return clause.Eq{Column: column, Value: value}, nil
+		case "!=":
+			return clause.Neq{Column: column, Value: value}, nil
+		case "<":
+			return clause.Lt{Column: column, Value: value}, nil
+		case "<=":
+			return clause.Lte{Column: column, Value: value}, nil
+		case ">":
+			return clause.Gt{Column: column, Value: value}, nil
+		default:
+			return clause.Gte{Column: column, Value: value}, nil
+		}
+
+	default:
+		return nil, unexpected(op, "operator")
+	}
+}
+
+// field 返回词法单元指定的字段，字段必须在白名单中.
+func (p *parser) field(tok token) (*schema.Field, error) {
+	field, ok := p.fields[tok.text]
+	if !ok || !p.allowed[field] {
+		return nil, syntaxError(tok.pos, "unsupported filter field %q", tok.text).KV("field", tok.text)
+	}
+	return field, nil
+}
+
+// value 读取一个值并按字段的类型转换. nullable 表示是否允许 null.
+func (p *parser) value(field *schema.Field, nullable bool) (any, error) {
+	tok := p.advance()
+	if tok.kind != tokenWord && tok.kind != tokenString {
+		return nil, unexpected(tok, "value")
+	}
+	if tok.kind == tokenWord && tok.is("null") {
+		if !nullable {
+			return nil, syntaxError(tok.pos, "null can only be compared with = or !=")
+		}
+		return nil, nil
+	}
+
+	value, err := coerce(field, tok.text)
+	if err != nil {
+		return nil, syntaxError(tok.pos, "invalid value %q for field %q", tok.text, field.Name).KV("field", field.Name)
+	}
+	return value, nil
+}
+
+// coerce 将值转换为字段的类型.
+func coerce(field *schema.Field, text string) (any, error) {
+	switch field.GORMDataType {
+	case schema.Bool:
+		return strconv.ParseBool(text)
+	case schema.Int:
+		return strconv.ParseInt(text, 10, 64)
+	case schema.Uint:
+		return strconv.ParseUint(text, 10, 64)
+	case schema.Float:
+		return strconv.ParseFloat(text, 64)
+	case schema.Time:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid time %q", text)
+	default:
+		return text, nil
+	}
+}
+
+// unexpected 返回表示遇到了意外的词法单元的错误.
+func unexpected(tok token, want string) *errorsx.ErrorX {
+	if tok.kind == tokenEOF {
+		return syntaxError(tok.pos, "expected %s, got end of filter", want)
+	}
+	return syntaxError(tok.pos, "expected %s, got %q", want, tok.text)
+}
+
+// syntaxError 返回表示过滤表达式无效的错误，元数据中的 position 为出错位置的字节偏移量.
+func syntaxError(pos int, format string, args ...any) *errorsx.ErrorX {
+	return errorsx.New(errorsx.ErrInvalidArgument.Code, errorsx.ErrInvalidArgument.Reason,
+		"Invalid filter at position %d: %s", pos, fmt.Sprintf(format, args...)).
+		KV("position", strconv.Itoa(pos))
+}
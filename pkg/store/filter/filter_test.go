@@ -0,0 +1,153 @@
+package filter_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/store/filter"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type Task struct {
+	ID        int64
+	Name      string `json:"name"`
+	Status    string `gorm:"column:state" json:"status"`
+	Priority  int
+	Done      bool
+	CreatedAt time.Time `json:"createdAt"`
+	DeletedAt *time.Time
+}
+
+// toSQL 返回过滤表达式生成的 SQL 条件和参数.
+func toSQL(t *testing.T, parser *filter.Parser, expr string) (string, []any) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true, Logger: logger.Discard})
+	require.NoError(t, err)
+
+	opt, err := parser.Where(expr)
+	require.NoError(t, err)
+
+	stmt := where.NewWhere(opt).Where(db.Model(&Task{})).Find(&[]Task{}).Statement
+	sql := stmt.SQL.String()
+	return strings.TrimSpace(strings.TrimPrefix(sql, "SELECT * FROM `tasks`")), stmt.Vars
+}
+
+// allFields 是 TestParser 中允许过滤的字段，混用了字段名、列名和 json 标签名.
+var allFields = []string{"name", "state", "createdAt", "Priority", "done", "DeletedAt"}
+
+func TestParser(t *testing.T) {
+	parser, err := filter.NewParser(&Task{}, filter.WithAllowlist(allFields...))
+	require.NoError(t, err)
+
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		expr string
+		sql  string
+		vars []any
+	}{
+		{"", "", nil},
+		{"name = foo", "WHERE `name` = ?", []any{"foo"}},
+		{`name != "foo bar"`, "WHERE `name` <> ?", []any{"foo bar"}},
+		{"status in (active, pending) and createdAt > 2025-01-01", "WHERE `state` IN (?,?) AND `created_at` > ?", []any{"active", "pending", created}},
+		{"Priority >= 3 OR done = true", "WHERE (`priority` >= ? OR `done` = ?)", []any{int64(3), true}},
+		{"not (name like 'a%' or priority < 2) and deleted_at = null", "WHERE NOT (`name` LIKE ? OR `priority` < ?) AND `deleted_at` IS NULL", []any{"a%", int64(2)}},
+		{"deleted_at != NULL", "WHERE `deleted_at` IS NOT NULL", nil},
+		{`name = 'it\'s'`, "WHERE `name` = ?", []any{"it's"}},
+		{"Status = active and state != closed", "WHERE `state` = ? AND `state` <> ?", []any{"active", "closed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			sql, vars := toSQL(t, parser, tt.expr)
+			assert.Equal(t, tt.sql, sql)
+			if tt.vars == nil {
+				assert.Empty(t, vars)
+			} else {
+				assert.Equal(t, tt.vars, vars)
+			}
+		})
+	}
+}
+
+func TestParser_Errors(t *testing.T) {
+	parser, err := filter.NewParser(&Task{}, filter.WithAllowlist("name", "status", "priority", "createdAt"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		expr     string
+		position string
+	}{
+		{"done = true", "0"},            // 不在白名单中
+		{"Done = true", "0"},            // 不在白名单中的字段名
+		{"password = x", "0"},           // 不存在的字段
+		{"priority > high", "11"},       // 类型不匹配
+		{"createdAt > yesterday", "12"}, // 无效的时间
+		{"priority like 1", "9"},        // like 只支持字符串
+		{"name = foo and", "14"},        // 缺少条件
+		{"(name = foo", "11"},           // 缺少右括号
+		{"status in (a b)", "13"},       // 缺少逗号
+		{"name = 'foo", "7"},            // 未结束的字符串
+		{"name = foo bar", "11"},        // 多余的内容
+		{"priority < null", "11"},       // null 只能用于 = 和 !=
+		{"name ! foo", "5"},             // 无效的运算符
+		{"; DROP TABLE tasks", "0"},     // 不是字段
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parser.Parse(tt.expr)
+			require.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+			assert.Equal(t, tt.position, errorsx.FromError(err).Metadata["position"])
+		})
+	}
+}
+
+func TestNewParser_Allowlist(t *testing.T) {
+	// 未设置白名单时不允许过滤任何字段
+	_, err := filter.NewParser(&Task{})
+	require.ErrorIs(t, err, filter.ErrAllowlistRequired)
+
+	_, err = filter.NewParser(&Task{}, filter.WithAllowlist("name", "password"))
+	assert.ErrorContains(t, err, `"password"`)
+
+	// 白名单按字段匹配，字段名、列名和 json 标签名等价
+	for _, name := range []string{"Status", "state", "status"} {
+		parser, err := filter.NewParser(&Task{}, filter.WithAllowlist(name))
+		require.NoError(t, err)
+		for _, expr := range []string{"Status = a", "state = a", "status = a"} {
+			_, err := parser.Parse(expr)
+			assert.NoError(t, err, "allowlist %s, expr %s", name, expr)
+		}
+		_, err = parser.Parse("name = a")
+		assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+	}
+}
+
+func TestParser_Query(t *testing.T) {
+	db := dbtest.NewSQLite(t, nil, &Task{})
+	require.NoError(t, db.Create([]*Task{
+		{Name: "a", Status: "active", Priority: 1},
+		{Name: "b", Status: "pending", Priority: 5},
+		{Name: "c", Status: "closed", Priority: 5},
+	}).Error)
+
+	parser, err := filter.NewParser(&Task{}, filter.WithAllowlist("name", "status", "priority"))
+	require.NoError(t, err)
+	opt, err := parser.Where("status in (active, pending) and (priority > 3 or name = a)")
+	require.NoError(t, err)
+
+	var tasks []Task
+	require.NoError(t, where.NewWhere(opt).Where(db).Order("id").Find(&tasks).Error)
+	require.Len(t, tasks, 2)
+	assert.Equal(t, "a", tasks[0].Name)
+	assert.Equal(t, "b", tasks[1].Name)
+}
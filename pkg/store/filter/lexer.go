@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"strings"
+)
+
+// tokenKind 表示词法单元的类型.
+type tokenKind int
+
+const (
+	tokenEOF      tokenKind = iota
+	tokenWord               // 字段名、关键字或未加引号的值
+	tokenString             // 加引号的值
+	tokenOperator           // 比较运算符
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+// token 表示过滤表达式中的一个词法单元.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 在表达式中的字节偏移量
+}
+
+// is 判断 token 是否为给定的关键字，关键字不区分大小写.
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// lex 将过滤表达式切分为词法单元.
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			op := string(c)
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, syntaxError(i, "unexpected character '!'")
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		case c == '"' || c == '\'':
+			text, n, err := lexString(expr[i:])
+			if err != nil {
+				return nil, syntaxError(i, "%v", err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i += n
+		default:
+			start := i
+			for i < len(expr) && isWordChar(expr[i]) {
+				i++
+			}
+			if i == start {
+				return nil, syntaxError(i, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: expr[start:i], pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+// lexString 读取以引号开头的字符串，返回去掉引号和转义后的内容以及读取的字节数.
+// 字符串内可以使用反斜杠转义引号和反斜杠本身.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, errUnterminated
+			}
+			i++
+			b.WriteByte(s[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errUnterminated
+}
+
+// isWordChar 判断字节是否可以出现在未加引号的单词中.
+func isWordChar(c byte) bool {
+	return !strings.ContainsRune(" \t\n\r(),=<>!\"'", rune(c))
+}
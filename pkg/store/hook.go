@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// Operation is the kind of a Mutation.
+type Operation string
+
+const (
+	// OperationCreate is the creation of objects.
+	OperationCreate Operation = "create"
+	// OperationUpdate is the update of objects, including their restoration.
+	OperationUpdate Operation = "update"
+	// OperationDelete is the deletion of objects, soft or not.
+	OperationDelete Operation = "delete"
+)
+
+// Mutation describes a change of objects made by a Store, for hooks.
+type Mutation[T any] struct {
+	Operation Operation
+	// Method is the name of the Store method, e.g. "UpdateFields".
+	Method string
+	// Before are the objects affected by the mutation as they were before it,
+	// loaded in the transaction of the mutation. It is empty for creations.
+	Before []*T
+	// After are the objects affected by the mutation as they are after it.
+	// It is set once the mutation succeeded, and empty for deletions.
+	After []*T
+}
+
+// Hook is called around the mutations of a Store. Both methods are called in
+// the transaction of the mutation, which is carried by ctx, so that returning
+// an error rolls the mutation back, and AfterCommit can be used to act once
+// the mutation is committed.
+type Hook[T any] interface {
+	// Before is called before the mutation. An error aborts it.
+	Before(ctx context.Context, m *Mutation[T]) error
+	// After is called after the mutation, if it succeeded. An error rolls it back.
+	After(ctx context.Context, m *Mutation[T]) error
+}
+
+// HookFuncs is a Hook calling the given functions, which may be nil.
+type HookFuncs[T any] struct {
+	BeforeFunc func(ctx context.Context, m *Mutation[T]) error
+	AfterFunc  func(ctx context.Context, m *Mutation[T]) error
+}
+
+// Ensure HookFuncs implements the Hook interface.
+var _ Hook[any] = HookFuncs[any]{}
+
+// Before implements Hook.
+func (h HookFuncs[T]) Before(ctx context.Context, m *Mutation[T]) error {
+	if h.BeforeFunc == nil {
+		return nil
+	}
+	return h.BeforeFunc(ctx, m)
+}
+
+// After implements Hook.
+func (h HookFuncs[T]) After(ctx context.Context, m *Mutation[T]) error {
+	if h.AfterFunc == nil {
+		return nil
+	}
+	return h.AfterFunc(ctx, m)
+}
+
+// WithHooks returns an Option function that adds hooks called around Create,
+// CreateInBatches, Update, UpdateFields, BatchUpdate, Restore, Delete,
+// BatchDelete, SoftDelete and Purge, which then run in a transaction, or a
+// savepoint if ctx already carries a transaction. Upsert is not hooked, see
+// Upsert. Loading the objects as they were before and after the mutation
+// costs up to two additional queries.
+func WithHooks[T any](hooks ...Hook[T]) Option[T] {
+	return func(s *Store[T]) {
+		s.hooks = append(s.hooks, hooks...)
+	}
+}
+
+// mutation defines how a Store method mutates objects, for mutate.
+type mutation[T any] struct {
+	operation Operation
+	method    string
+	// before loads the objects affected by the mutation, if any
+	before func(ctx context.Context) ([]*T, error)
+	// run makes the mutation
+	run func(ctx context.Context) error
+	// after loads the affected objects after the mutation, given the ones
+	// returned by before, for creations and updates
+	after func(ctx context.Context, before []*T) ([]*T, error)
+}
+
+// mutate runs the mutation, with the hooks around it if there are some.
+func (s *Store[T]) mutate(ctx context.Context, mu mutation[T]) error {
+	if len(s.hooks) == 0 {
+		return mu.run(ctx)
+	}
+
+	return NewTxManager(s.storage.DB(ctx)).RunInTx(ctx, func(ctx context.Context) error {
+		m := &Mutation[T]{Operation: mu.operation, Method: mu.method}
+		var err error
+		if mu.before != nil {
+			if m.Before, err = mu.before(ctx); err != nil {
+				return err
+			}
+		}
+		for _, hook := range s.hooks {
+			if err := hook.Before(ctx, m); err != nil {
+				return err
+			}
+		}
+
+		if err := mu.run(ctx); err != nil {
+			return err
+		}
+
+		if mu.after != nil {
+			if m.After, err = mu.after(ctx, m.Before); err != nil {
+				return err
+			}
+		}
+		for _, hook := range s.hooks {
+			if err := hook.After(ctx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// selected returns a function loading the objects selected by the where
+// options and restricted by scope.
+func (s *Store[T]) selected(opts *where.Options, scope func(db *gorm.DB) (*gorm.DB, error)) func(ctx context.Context) ([]*T, error) {
+	return func(ctx context.Context) ([]*T, error) {
+		db, err := scope(s.db(ctx, opts))
+		if err != nil {
+			return nil, err
+		}
+
+		var objs []*T
+		err = db.Offset(-1).Limit(-1).Find(&objs).Error
+		return objs, err
+	}
+}
+
+// objects returns a function returning the given objects.
+func objects[T any](objs ...*T) func(ctx context.Context, before []*T) ([]*T, error) {
+	return func(context.Context, []*T) ([]*T, error) {
+		return objs, nil
+	}
+}
+
+// reload loads again the given objects by primary key, soft-deleted or not.
+func (s *Store[T]) reload(ctx context.Context, objs []*T) ([]*T, error) {
+	if len(objs) == 0 {
+		return nil, nil
+	}
+
+	db := s.db(ctx)
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, gorm.ErrPrimaryKeyRequired
+	}
+
+	keys := make([]any, 0, len(objs))
+	for _, obj := range objs {
+		key, _ := pk.ValueOf(ctx, reflect.ValueOf(obj))
+		keys = append(keys, key)
+	}
+
+	var ret []*T
+	err := db.Unscoped().Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Values: keys}).Find(&ret).Error
+	return ret, err
+}
+
+// current returns a function loading the given objects as they are in the database.
+func (s *Store[T]) current(objs ...*T) func(ctx context.Context) ([]*T, error) {
+	return func(ctx context.Context) ([]*T, error) {
+		return s.reload(ctx, objs)
+	}
+}
+
+// reloaded returns a function loading the given objects as they are in the
+// database, for mutations whose affected objects are known beforehand.
+func (s *Store[T]) reloaded(objs ...*T) func(ctx context.Context, before []*T) ([]*T, error) {
+	return func(ctx context.Context, _ []*T) ([]*T, error) {
+		return s.reload(ctx, objs)
+	}
+}
+
+// unrestricted is a scope for selected which leaves db as is.
+func unrestricted(db *gorm.DB) (*gorm.DB, error) {
+	return db, nil
+}
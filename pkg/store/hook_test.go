@@ -0,0 +1,92 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// names 返回用户名列表.
+func names(users []*User) []string {
+	ret := make([]string, 0, len(users))
+	for _, user := range users {
+		ret = append(ret, user.Name)
+	}
+	return ret
+}
+
+func TestStore_Hooks(t *testing.T) {
+	ctx := context.Background()
+	var mutations []store.Mutation[User]
+	users := store.NewStore[User](store.NewTxManager(newDB(t)), nil, store.WithHooks[User](store.HookFuncs[User]{
+		AfterFunc: func(ctx context.Context, m *store.Mutation[User]) error {
+			mutations = append(mutations, *m)
+			return nil
+		},
+	}))
+
+	alice := &User{Name: "alice"}
+	require.NoError(t, users.Create(ctx, alice))
+	_, err := users.CreateInBatches(ctx, []*User{{Name: "bob"}, {Name: "carol"}}, 0)
+	require.NoError(t, err)
+	require.NoError(t, users.UpdateFields(ctx, &User{ID: alice.ID, Name: "alicia"}, store.FieldPaths{"name"}))
+	_, err = users.BatchUpdate(ctx, where.F("name", "bob"), map[string]any{"name": "robert"})
+	require.NoError(t, err)
+	require.NoError(t, users.Delete(ctx, where.F("name", "carol")))
+
+	require.Len(t, mutations, 5)
+	assert.Equal(t, store.OperationCreate, mutations[0].Operation)
+	assert.Equal(t, []string{"alice"}, names(mutations[0].After))
+	assert.Equal(t, "CreateInBatches", mutations[1].Method)
+	assert.Equal(t, []string{"bob", "carol"}, names(mutations[1].After))
+
+	// 更新前后的状态都从数据库加载
+	assert.Equal(t, store.OperationUpdate, mutations[2].Operation)
+	assert.Equal(t, []string{"alice"}, names(mutations[2].Before))
+	assert.Equal(t, []string{"alicia"}, names(mutations[2].After))
+	assert.Equal(t, []string{"bob"}, names(mutations[3].Before))
+	assert.Equal(t, []string{"robert"}, names(mutations[3].After))
+
+	assert.Equal(t, store.OperationDelete, mutations[4].Operation)
+	assert.Equal(t, []string{"carol"}, names(mutations[4].Before))
+	assert.Empty(t, mutations[4].After)
+
+	// Upsert 不调用钩子
+	_, err = users.Upsert(ctx, []*User{{ID: alice.ID, Name: "alice"}}, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, mutations, 5)
+}
+
+func TestStore_HooksRollback(t *testing.T) {
+	ctx := context.Background()
+	errDenied := errors.New("denied")
+	users := store.NewStore[User](store.NewTxManager(newDB(t)), nil, store.WithHooks[User](
+		store.HookFuncs[User]{BeforeFunc: func(ctx context.Context, m *store.Mutation[User]) error {
+			if m.Operation == store.OperationDelete {
+				return errDenied
+			}
+			return nil
+		}},
+		store.HookFuncs[User]{AfterFunc: func(ctx context.Context, m *store.Mutation[User]) error {
+			if m.After[0].Name == "mallory" {
+				return errDenied
+			}
+			return nil
+		}},
+	))
+
+	// Before 返回错误时不执行变更
+	require.NoError(t, users.Create(ctx, &User{Name: "alice"}))
+	require.ErrorIs(t, users.Delete(ctx, where.F("name", "alice")), errDenied)
+	assert.EqualValues(t, 1, count(t, users))
+
+	// After 返回错误时回滚变更
+	require.ErrorIs(t, users.Create(ctx, &User{Name: "mallory"}), errDenied)
+	assert.EqualValues(t, 1, count(t, users))
+}
@@ -0,0 +1,4 @@
+// Package migrate applies versioned database migrations, written as Go
+// functions or as SQL files, and records them in a history table. It
+// complements registry.Migrate, which can only create and update tables.
+package migrate // import "github.com/LiangNing7/goutils/pkg/store/migrate"
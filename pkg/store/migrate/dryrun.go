@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// sqlWriter is a GORM logger writing the SQL statements of a dry run.
+type sqlWriter struct {
+	w io.Writer
+}
+
+// Ensure sqlWriter implements the logger.Interface interface.
+var _ logger.Interface = (*sqlWriter)(nil)
+
+// LogMode implements logger.Interface.
+func (l *sqlWriter) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+// Info implements logger.Interface.
+func (l *sqlWriter) Info(context.Context, string, ...any) {}
+
+// Warn implements logger.Interface.
+func (l *sqlWriter) Warn(context.Context, string, ...any) {}
+
+// Error implements logger.Interface.
+func (l *sqlWriter) Error(context.Context, string, ...any) {}
+
+// Trace implements logger.Interface. It writes the statement.
+func (l *sqlWriter) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if sql, _ := fc(); sql != "" {
+		fmt.Fprintf(l.w, "%s;\n", sql)
+	}
+}
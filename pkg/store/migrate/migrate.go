@@ -0,0 +1,281 @@
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/logger"
+	"github.com/LiangNing7/goutils/pkg/logger/empty"
+)
+
+const (
+	// DefaultTable is the name of the migrations history table.
+	DefaultTable = "schema_migrations"
+	// DefaultLockName is the name of the lock guarding migrations.
+	DefaultLockName = "schema-migrations"
+)
+
+// ErrIrreversible is returned by Down for migrations without Down function.
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// History is a record of the migrations history table.
+type History struct {
+	Version     int64 `gorm:"primaryKey;autoIncrement:false"`
+	Description string
+	AppliedAt   time.Time
+}
+
+// Status is the status of a migration.
+type Status struct {
+	Version     int64
+	Description string
+	// AppliedAt is when the migration was applied, or nil if it is pending.
+	AppliedAt *time.Time
+}
+
+// Option configures the Migrator.
+type Option func(*Migrator)
+
+// Migrator applies and reverts versioned migrations, recording the applied
+// ones in a history table. Each migration runs in a transaction together with
+// its history record, so that it is applied entirely or not at all on
+// databases with transactional DDL like PostgreSQL. MySQL commits DDL
+// statements implicitly, so a migration mixing several of them should be
+// split. Concurrent runs, e.g. by the instances of a service starting at the
+// same time, are serialized by a distlock lock.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	table      string
+	locker     distlock.Locker
+	dryRun     io.Writer
+	logger     logger.Logger
+}
+
+// WithTable sets the name of the migrations history table, DefaultTable by default.
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithLocker sets the lock guarding migrations. By default a
+// distlock.GORMLocker named DefaultLockName on the database is used.
+func WithLocker(locker distlock.Locker) Option {
+	return func(m *Migrator) {
+		m.locker = locker
+	}
+}
+
+// WithDryRun makes the Migrator write the SQL statements of the migrations to
+// w instead of executing them. Queries run by Go migrations return no rows in
+// a dry run, so migrations depending on their results may print statements
+// which would not be executed.
+func WithDryRun(w io.Writer) Option {
+	return func(m *Migrator) {
+		m.dryRun = w
+	}
+}
+
+// WithLogger sets the logger of the Migrator.
+func WithLogger(logger logger.Logger) Option {
+	return func(m *Migrator) {
+		m.logger = logger
+	}
+}
+
+// NewMigrator creates a new Migrator of the given migrations, which must
+// have distinct versions.
+func NewMigrator(db *gorm.DB, migrations []Migration, opts ...Option) (*Migrator, error) {
+	m := &Migrator{
+		db:     db,
+		table:  DefaultTable,
+		logger: empty.NewLogger(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.migrations = slices.Clone(migrations)
+	slices.SortFunc(m.migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	for i, migration := range m.migrations {
+		if migration.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up function", migration.Version)
+		}
+		if i > 0 && m.migrations[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migration.Version)
+		}
+	}
+
+	if m.locker == nil && m.dryRun == nil {
+		locker, err := distlock.NewGORMLocker(db, distlock.WithLockName(DefaultLockName))
+		if err != nil {
+			return nil, err
+		}
+		m.locker = locker
+	}
+	return m, nil
+}
+
+// Up applies the pending migrations in order of version.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpTo(ctx, -1)
+}
+
+// UpTo applies the pending migrations up to the given version included, or
+// all of them if version is negative. Pending migrations older than applied
+// ones are applied as well.
+func (m *Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.run(ctx, func(ctx context.Context, applied map[int64]History) error {
+		for _, migration := range m.migrations {
+			if version >= 0 && migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, migration, "up", migration.Up); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the given number of applied migrations, most recent first.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.run(ctx, func(ctx context.Context, applied map[int64]History) error {
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("failed to revert migration %d: %w", migration.Version, ErrIrreversible)
+			}
+			if err := m.apply(ctx, migration, "down", migration.Down); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status returns the status of the migrations in order of version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Description: migration.Description}
+		if history, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &history.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// run runs fn with the applied migrations while holding the lock. The
+// context passed to fn is cancelled if the lock is lost.
+func (m *Migrator) run(ctx context.Context, fn func(ctx context.Context, applied map[int64]History) error) error {
+	if m.dryRun == nil {
+		if _, err := distlock.NewBlockingLocker(m.locker).LockWait(ctx); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer func() {
+			if err := m.locker.Unlock(context.WithoutCancel(ctx)); err != nil {
+				m.logger.Error("Failed to release migration lock", "err", err)
+			}
+		}()
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		lost := m.locker.Lost()
+		go func() {
+			select {
+			case <-lost:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		if err := m.db.WithContext(ctx).Table(m.table).AutoMigrate(&History{}); err != nil {
+			return fmt.Errorf("failed to create migrations history table: %w", err)
+		}
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, applied)
+}
+
+// applied returns the applied migrations by version.
+func (m *Migrator) applied(ctx context.Context) (map[int64]History, error) {
+	applied := map[int64]History{}
+	db := m.db.WithContext(ctx)
+	if !db.Migrator().HasTable(m.table) {
+		return applied, nil
+	}
+
+	var histories []History
+	if err := db.Table(m.table).Find(&histories).Error; err != nil {
+		return nil, fmt.Errorf("failed to read migrations history: %w", err)
+	}
+	for _, history := range histories {
+		applied[history.Version] = history
+	}
+	return applied, nil
+}
+
+// apply runs fn, the up or down function of migration, and records it in the
+// history table, in a transaction.
+func (m *Migrator) apply(ctx context.Context, migration Migration, direction string, fn func(ctx context.Context, tx *gorm.DB) error) error {
+	if m.dryRun != nil {
+		fmt.Fprintf(m.dryRun, "-- %d %s (%s)\n", migration.Version, migration.Description, direction)
+		db := m.db.Session(&gorm.Session{DryRun: true, Logger: &sqlWriter{w: m.dryRun}, Context: ctx})
+		if err := fn(ctx, db); err != nil {
+			return fmt.Errorf("failed to run migration %d %s: %w", migration.Version, direction, err)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		if direction == "down" {
+			return tx.Table(m.table).Delete(&History{}, migration.Version).Error
+		}
+		return tx.Table(m.table).Create(&History{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		}).Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to run migration", "version", migration.Version, "direction", direction, "err", err)
+		return fmt.Errorf("failed to run migration %d %s: %w", migration.Version, direction, err)
+	}
+	m.logger.Info("Successfully ran migration", "version", migration.Version, "description", migration.Description,
+		"direction", direction, "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,195 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/store/migrate"
+)
+
+type User struct {
+	ID   int64
+	Name string
+}
+
+func newDB(t *testing.T) *gorm.DB {
+	return dbtest.NewSQLite(t, nil)
+}
+
+// migrations 返回测试用的迁移: 建表, 加列并回填数据.
+func migrations(t *testing.T) []migrate.Migration {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.up.sql": {Data: []byte(`
+-- 添加 email 列; 并回填
+ALTER TABLE users ADD COLUMN email TEXT;
+UPDATE users SET email = name || '@example.com';`)},
+		"migrations/0002_add_email.down.sql":       {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+		"migrations/0002_add_email.down.mysql.sql": {Data: []byte("ALTER TABLE `users` DROP COLUMN `email`;")},
+		"migrations/0003_seed.up.postgres.sql":     {Data: []byte("INSERT INTO users (name) VALUES ('postgres');")},
+		"migrations/0003_seed.up.sql":              {Data: []byte("INSERT INTO users (name) VALUES ('carol');")},
+		"migrations/0003_seed.down.sql":            {Data: []byte("DELETE FROM users WHERE name = 'carol';")},
+		"migrations/README.md":                     {Data: []byte("忽略非迁移文件")},
+	}
+	list, err := migrate.FromFS(fsys, "migrations", "sqlite")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	return append(list, migrate.Migration{
+		Version:     1,
+		Description: "create users",
+		Up: func(ctx context.Context, tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&User{}); err != nil {
+				return err
+			}
+			return tx.Create([]*User{{Name: "alice"}, {Name: "bob"}}).Error
+		},
+		Down: func(ctx context.Context, tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&User{})
+		},
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	m, err := migrate.NewMigrator(db, migrations(t))
+	require.NoError(t, err)
+
+	require.NoError(t, m.UpTo(ctx, 2))
+	var emails []string
+	require.NoError(t, db.Table("users").Order("id").Pluck("email", &emails).Error)
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, emails)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "add email", statuses[1].Description)
+	assert.NotNil(t, statuses[1].AppliedAt)
+	assert.Nil(t, statuses[2].AppliedAt)
+
+	// 已执行的迁移不会重复执行
+	require.NoError(t, m.Up(ctx))
+	require.NoError(t, m.Up(ctx))
+	var names []string
+	require.NoError(t, db.Table("users").Order("id").Pluck("name", &names).Error)
+	assert.Equal(t, []string{"alice", "bob", "carol"}, names)
+
+	// 回滚最近的两个迁移
+	require.NoError(t, m.Down(ctx, 2))
+	assert.False(t, db.Migrator().HasColumn(&User{}, "email"))
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+}
+
+func TestMigrator_Failure(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	errFailed := errors.New("failed")
+	m, err := migrate.NewMigrator(db, []migrate.Migration{
+		migrate.AutoMigrate(1, "create users", &User{}),
+		{Version: 2, Up: func(ctx context.Context, tx *gorm.DB) error {
+			if err := tx.Create(&User{Name: "alice"}).Error; err != nil {
+				return err
+			}
+			return errFailed
+		}},
+	})
+	require.NoError(t, err)
+
+	// 失败的迁移整体回滚, 且不会被记录
+	require.ErrorIs(t, m.Up(ctx), errFailed)
+	var count int64
+	require.NoError(t, db.Model(&User{}).Count(&count).Error)
+	assert.Zero(t, count)
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+
+	// 没有 Down 的迁移无法回滚
+	m, err = migrate.NewMigrator(db, []migrate.Migration{{Version: 1, Up: func(context.Context, *gorm.DB) error { return nil }}})
+	require.NoError(t, err)
+	require.ErrorIs(t, m.Down(ctx, 1), migrate.ErrIrreversible)
+
+	_, err = migrate.NewMigrator(db, []migrate.Migration{migrate.AutoMigrate(1, "a"), migrate.AutoMigrate(1, "b")})
+	require.Error(t, err)
+}
+
+func TestMigrator_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	registry := distlock.NewMemoryRegistry()
+
+	var (
+		mu   sync.Mutex
+		runs int
+	)
+	list := []migrate.Migration{{Version: 1, Up: func(ctx context.Context, tx *gorm.DB) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		return nil
+	}}}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		m, err := migrate.NewMigrator(db, list, migrate.WithLocker(distlock.NewMemoryLocker(registry)))
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.Up(ctx))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, runs)
+}
+
+func TestMigrator_DryRun(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	var out bytes.Buffer
+	m, err := migrate.NewMigrator(db, migrations(t), migrate.WithDryRun(&out))
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up(ctx))
+	assert.Contains(t, out.String(), "-- 1 create users (up)\n")
+	assert.Contains(t, out.String(), "CREATE TABLE `users`")
+	assert.Contains(t, out.String(), "-- 2 add email (up)\n")
+	assert.Contains(t, out.String(), "ALTER TABLE users ADD COLUMN email TEXT;\nUPDATE users SET email = name || '@example.com';\n")
+	assert.Contains(t, out.String(), "INSERT INTO users (name) VALUES ('carol');")
+
+	// 没有执行任何语句
+	assert.False(t, db.Migrator().HasTable(&User{}))
+	assert.False(t, db.Migrator().HasTable(migrate.DefaultTable))
+}
+
+func TestSQL_Statements(t *testing.T) {
+	var out bytes.Buffer
+	m, err := migrate.NewMigrator(newDB(t), []migrate.Migration{migrate.SQL(1, "functions", `
+INSERT INTO t VALUES ('a;b', "c;d", 'it''s;', 'e\';f'); -- 注释;
+/* 注释; */ CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+;
+SELECT $$;$$`, "")}, migrate.WithDryRun(&out))
+	require.NoError(t, err)
+	require.NoError(t, m.Up(context.Background()))
+
+	assert.Equal(t, `-- 1 functions (up)
+INSERT INTO t VALUES ('a;b', "c;d", 'it''s;', 'e\';f');
+-- 注释;
+/* 注释; */ CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+SELECT $$;$$;
+`, out.String())
+}
@@ -0,0 +1,219 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sqlFilePattern matches the names of SQL migration files, e.g.
+// "0002_add_email.up.sql" or "0002_add_email.down.postgres.sql".
+var sqlFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)(?:\.(\w+))?\.sql$`)
+
+// Migration is a versioned change of the database schema or data.
+type Migration struct {
+	// Version orders the migrations, e.g. 1, 2, 3 or a timestamp like 20250101120000.
+	Version int64
+	// Description tells what the migration does.
+	Description string
+	// Up applies the migration.
+	Up func(ctx context.Context, tx *gorm.DB) error
+	// Down reverts the migration. Migrations without Down cannot be reverted.
+	// +optional
+	Down func(ctx context.Context, tx *gorm.DB) error
+}
+
+// AutoMigrate returns a Migration creating or updating the tables of the
+// given models with GORM's AutoMigrate, e.g. the models of a registry.Registry.
+// Its Down drops the tables.
+func AutoMigrate(version int64, description string, models ...any) Migration {
+	return Migration{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context, tx *gorm.DB) error {
+			return tx.AutoMigrate(models...)
+		},
+		Down: func(ctx context.Context, tx *gorm.DB) error {
+			return tx.Migrator().DropTable(models...)
+		},
+	}
+}
+
+// SQL returns a Migration running the given SQL scripts, which may contain
+// several statements separated by semicolons.
+func SQL(version int64, description, up, down string) Migration {
+	m := Migration{Version: version, Description: description, Up: execSQL(up)}
+	if down != "" {
+		m.Down = execSQL(down)
+	}
+	return m
+}
+
+// FromFS returns the migrations defined by the SQL files of dir in fsys,
+// typically an embed.FS. Files are named "<version>_<description>.up.sql" and
+// "<version>_<description>.down.sql". A file can be restricted to a database
+// by adding the name of its GORM dialector, e.g. "0001_init.up.mysql.sql" and
+// "0001_init.up.postgres.sql"; such files take precedence over the generic one
+// for that database.
+func FromFS(fsys fs.FS, dir string, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type script struct {
+		sql      string
+		specific bool // Whether the script is specific to the dialect
+	}
+	type scripts struct {
+		description string
+		up, down    *script
+	}
+
+	byVersion := map[int64]*scripts{}
+	var versions []int64
+	for _, entry := range entries {
+		match := sqlFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		if match[4] != "" && match[4] != dialect {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration file %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := byVersion[version]
+		if !ok {
+			s = &scripts{description: strings.ReplaceAll(match[2], "_", " ")}
+			byVersion[version] = s
+			versions = append(versions, version)
+		}
+		target := &s.up
+		if match[3] == "down" {
+			target = &s.down
+		}
+		specific := match[4] != ""
+		if *target != nil && (*target).specific == specific {
+			return nil, fmt.Errorf("duplicate %s migration file for version %d", match[3], version)
+		}
+		if *target == nil || specific {
+			*target = &script{sql: string(content), specific: specific}
+		}
+	}
+
+	migrations := make([]Migration, 0, len(versions))
+	for _, version := range versions {
+		s := byVersion[version]
+		if s.up == nil {
+			return nil, fmt.Errorf("missing up migration file for version %d", version)
+		}
+		down := ""
+		if s.down != nil {
+			down = s.down.sql
+		}
+		migrations = append(migrations, SQL(version, s.description, s.up.sql, down))
+	}
+	return migrations, nil
+}
+
+// execSQL returns a migration function executing the statements of script.
+func execSQL(script string) func(ctx context.Context, tx *gorm.DB) error {
+	return func(ctx context.Context, tx *gorm.DB) error {
+		for _, stmt := range splitStatements(script) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// splitStatements splits script into statements at the semicolons which are
+// not in a string, a quoted identifier, a comment or a PostgreSQL
+// dollar-quoted string. Empty statements are dropped.
+func splitStatements(script string) []string {
+	var (
+		stmts []string
+		start int
+	)
+	add := func(end int) {
+		if stmt := strings.TrimSpace(script[start:end]); stmt != "" && !onlyComments(stmt) {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// Quotes are escaped by doubling them, or with a backslash in MySQL
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' {
+					i++
+				}
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case c == '$':
+			if tag := dollarTag(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(script)
+				}
+			}
+		case c == ';':
+			add(i)
+			start = i + 1
+		}
+	}
+	add(len(script))
+	return stmts
+}
+
+// dollarTag returns the dollar-quote tag, like "$$" or "$body$", s starts with.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// onlyComments tells whether stmt only consists of comments.
+func onlyComments(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
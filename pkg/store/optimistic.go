@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+)
+
+// versionTag is the value of the `store` struct tag marking the version field
+// used for optimistic locking, e.g.:
+//
+//	Version int64 `store:"version"`
+const versionTag = "version"
+
+// DefaultConflictBackoff is the backoff used by RetryOnConflict when none is given.
+var DefaultConflictBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 10 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+// ConflictError is returned by Update, when optimistic locking is enabled, if
+// the object has been modified since it was read. It wraps
+// errorsx.ErrOperationFailed.
+type ConflictError struct {
+	// Version is the version of the object which was expected to be updated.
+	Version int64
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("object has been modified concurrently, version %d is out of date", e.Version)
+}
+
+// Unwrap returns the errorsx.ErrOperationFailed error wrapped by e.
+func (e *ConflictError) Unwrap() error {
+	return errorsx.New(errorsx.ErrOperationFailed.Code, errorsx.ErrOperationFailed.Reason,
+		"The object has been modified concurrently. Please reload it and try again.")
+}
+
+// IsConflict tells whether err is or wraps a ConflictError.
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict)
+}
+
+// WithOptimisticLock returns an Option function that enables optimistic
+// locking in Update. The model must have an integer field tagged with
+// `store:"version"`. Update then only updates the object if its version has
+// not changed since it was read, increments the version, and returns a
+// ConflictError otherwise.
+func WithOptimisticLock[T any]() Option[T] {
+	return func(s *Store[T]) {
+		s.optimisticLock = true
+	}
+}
+
+// RetryOnConflict runs fn, usually a read-modify-write of an object, again
+// while it fails with a ConflictError, waiting between attempts according to
+// backoff. The last error is returned once the attempts are exhausted. Uses
+// DefaultConflictBackoff when backoff has no steps.
+func RetryOnConflict(ctx context.Context, backoff wait.Backoff, fn func(ctx context.Context) error) error {
+	if backoff.Steps == 0 {
+		backoff = DefaultConflictBackoff
+	}
+
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		lastErr = fn(ctx)
+		switch {
+		case lastErr == nil:
+			return true, nil
+		case IsConflict(lastErr):
+			return false, nil
+		default:
+			return false, lastErr
+		}
+	})
+	if wait.Interrupted(err) && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// updateVersioned updates obj if its version in the database is still the
+// one of obj, and increments the version. Only the given columns are updated,
+// or all of them if columns is nil.
+func (s *Store[T]) updateVersioned(ctx context.Context, db *gorm.DB, obj *T, columns map[string]any) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(obj); err != nil {
+		return err
+	}
+
+	field := versionField(stmt.Schema)
+	if field == nil {
+		return fmt.Errorf("model %s has no integer field tagged `store:\"%s\"`", stmt.Schema.Name, versionTag)
+	}
+	if err := requirePrimaryKey(ctx, db, obj); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(obj)
+
+	value, _ := field.ValueOf(ctx, rv)
+	version := reflect.ValueOf(value).Convert(reflect.TypeOf(int64(0))).Int()
+	if err := field.Set(ctx, rv, version+1); err != nil {
+		return err
+	}
+
+	db = db.Model(obj).Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version})
+	var result *gorm.DB
+	if columns == nil {
+		result = db.Select("*").Updates(obj)
+	} else {
+		columns[field.DBName] = version + 1
+		result = db.Updates(columns)
+	}
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = &ConflictError{Version: version}
+	}
+	if result.Error != nil {
+		// Give the object its version back, so that it can be updated again
+		_ = field.Set(ctx, rv, version)
+		return result.Error
+	}
+	return nil
+}
+
+// versionField returns the version field of the schema, if any.
+func versionField(s *schema.Schema) *schema.Field {
+	for _, field := range s.Fields {
+		if field.Tag.Get("store") != versionTag || field.DBName == "" {
+			continue
+		}
+		if field.GORMDataType == schema.Int || field.GORMDataType == schema.Uint {
+			return field
+		}
+	}
+	return nil
+}
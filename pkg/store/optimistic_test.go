@@ -0,0 +1,97 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type Config struct {
+	ID      int64
+	Key     string
+	Value   string
+	Version int64 `store:"version"`
+}
+
+func newConfigStore(t *testing.T) *store.Store[Config] {
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Config{}))
+	return store.NewStore[Config](store.NewTxManager(db), nil, store.WithOptimisticLock[Config]())
+}
+
+func TestStore_OptimisticLock(t *testing.T) {
+	ctx := context.Background()
+	configs := newConfigStore(t)
+	require.NoError(t, configs.Create(ctx, &Config{Key: "k", Value: "v0"}))
+
+	// 两个调用方读取同一版本
+	a, err := configs.Get(ctx, where.F("key", "k"))
+	require.NoError(t, err)
+	b, err := configs.Get(ctx, where.F("key", "k"))
+	require.NoError(t, err)
+
+	a.Value = "a"
+	require.NoError(t, configs.Update(ctx, a))
+	assert.EqualValues(t, 1, a.Version)
+
+	// 基于旧版本的更新被拒绝，版本号保持不变
+	b.Value = "b"
+	err = configs.Update(ctx, b)
+	require.Error(t, err)
+	assert.True(t, store.IsConflict(err))
+	assert.ErrorIs(t, err, errorsx.ErrOperationFailed)
+	assert.EqualValues(t, 0, b.Version)
+
+	got, err := configs.Get(ctx, where.F("key", "k"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.Value)
+	assert.EqualValues(t, 1, got.Version)
+
+	// 没有主键时不更新
+	assert.Error(t, configs.Update(ctx, &Config{Key: "k"}))
+}
+
+func TestRetryOnConflict(t *testing.T) {
+	ctx := context.Background()
+	configs := newConfigStore(t)
+	require.NoError(t, configs.Create(ctx, &Config{Key: "k", Value: "0"}))
+
+	attempts := 0
+	err := store.RetryOnConflict(ctx, wait.Backoff{}, func(ctx context.Context) error {
+		attempts++
+		config, err := configs.Get(ctx, where.F("key", "k"))
+		if err != nil {
+			return err
+		}
+
+		// 第一次尝试时模拟并发修改
+		if attempts == 1 {
+			concurrent := *config
+			concurrent.Value = "concurrent"
+			require.NoError(t, configs.Update(ctx, &concurrent))
+		}
+
+		config.Value += "+1"
+		return configs.Update(ctx, config)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	got, err := configs.Get(ctx, where.F("key", "k"))
+	require.NoError(t, err)
+	assert.Equal(t, "concurrent+1", got.Value)
+	assert.EqualValues(t, 2, got.Version)
+
+	// 重试次数用尽后返回最后一次的冲突错误
+	err = store.RetryOnConflict(ctx, wait.Backoff{Steps: 2}, func(ctx context.Context) error {
+		return &store.ConflictError{Version: 1}
+	})
+	assert.True(t, store.IsConflict(err))
+}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"slices"
 	"sync"
 
 	"gorm.io/gorm"
@@ -35,6 +36,15 @@ func (r *Registry) Register(model any) {
 	r.models = append(r.models, model)
 }
 
+// Models 返回全局注册的所有模型, 可以配合 migrate.AutoMigrate 使用
+func Models() []any {
+	if globalRegistry == nil {
+		return nil
+	}
+
+	return globalRegistry.Models()
+}
+
 func Migrate(db *gorm.DB) error {
 	if globalRegistry == nil {
 		return nil
@@ -43,6 +53,11 @@ func Migrate(db *gorm.DB) error {
 	return globalRegistry.Migrate(db)
 }
 
+// Models 返回所有注册的模型
+func (r *Registry) Models() []any {
+	return slices.Clone(r.models)
+}
+
 // Migrate 执行所有注册模型的迁移
 func (r *Registry) Migrate(db *gorm.DB) error {
 	for _, model := range r.models {
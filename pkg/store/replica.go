@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// primaryKey is the context key under which WithPrimary marks reads to be
+// served by the primary.
+type primaryKey struct{}
+
+// ReadDBProvider is a DBProvider which serves reads from other databases,
+// typically read replicas. Get and the List methods of Store[T] use ReadDB,
+// and the other methods use DB.
+type ReadDBProvider interface {
+	DBProvider
+	// ReadDB returns the database instance serving reads for the given context.
+	ReadDB(ctx context.Context, wheres ...where.Where) *gorm.DB
+}
+
+// Replicas selects the read replica serving a read. It is implemented by
+// *db.Cluster.
+type Replicas interface {
+	// Replica returns the database serving the next read.
+	Replica() *gorm.DB
+}
+
+// Ensure TxManager implements the ReadDBProvider interface.
+var _ ReadDBProvider = (*TxManager)(nil)
+
+// WithReplicas returns a TxManagerOption that serves the reads of the stores
+// using the TxManager from the given replicas, and writes from the database
+// of the TxManager, usually the primary.
+func WithReplicas(replicas Replicas) TxManagerOption {
+	return func(m *TxManager) {
+		m.replicas = replicas
+	}
+}
+
+// WithPrimary returns a copy of ctx with which reads are served by the
+// primary instead of the replicas, e.g. to read one's own writes despite
+// replication lag.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// readsPrimary tells whether ctx was created by WithPrimary.
+func readsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// ReadDB implements ReadDBProvider. It returns a replica, unless ctx carries
+// a transaction or was created by WithPrimary, in which case it returns the
+// same database as DB.
+func (m *TxManager) ReadDB(ctx context.Context, wheres ...where.Where) *gorm.DB {
+	if _, ok := TxFromContext(ctx); ok || m.replicas == nil || readsPrimary(ctx) {
+		return m.DB(ctx, wheres...)
+	}
+
+	db := m.replicas.Replica().WithContext(ctx)
+	for _, whr := range wheres {
+		if whr != nil {
+			db = whr.Where(db)
+		}
+	}
+	return db
+}
@@ -0,0 +1,61 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+func TestTxManager_Replicas(t *testing.T) {
+	ctx := context.Background()
+	primary, replica1, replica2 := newDB(t), newDB(t), newDB(t)
+	require.NoError(t, replica1.Create(&User{ID: 100, Name: "replica1"}).Error)
+	require.NoError(t, replica2.Create(&User{ID: 100, Name: "replica2"}).Error)
+
+	cluster, err := db.NewCluster(primary, []*gorm.DB{replica1, replica2}, &db.RoundRobinPolicy{})
+	require.NoError(t, err)
+	txm := store.NewTxManager(cluster.Primary(), store.WithReplicas(cluster))
+	users := store.NewStore[User](txm, nil)
+
+	// 写入主库
+	require.NoError(t, users.Create(ctx, &User{ID: 1, Name: "primary"}))
+
+	// 读取按轮询策略路由到从库
+	var names []string
+	for range 4 {
+		user, err := users.Get(ctx, where.NewWhere())
+		require.NoError(t, err)
+		names = append(names, user.Name)
+	}
+	assert.Equal(t, []string{"replica1", "replica2", "replica1", "replica2"}, names)
+
+	// 强制读主库
+	user, err := users.Get(store.WithPrimary(ctx), where.NewWhere())
+	require.NoError(t, err)
+	assert.Equal(t, "primary", user.Name)
+
+	// 事务中的读取使用事务
+	require.NoError(t, txm.RunInTx(ctx, func(ctx context.Context) error {
+		_, list, err := users.List(ctx, where.NewWhere())
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "primary", list[0].Name)
+		return nil
+	}))
+
+	// 写操作不会路由到从库
+	require.NoError(t, users.Delete(ctx, where.F("id", 100)))
+	for _, replica := range cluster.Replicas() {
+		var n int64
+		require.NoError(t, replica.DB().Model(&User{}).Count(&n).Error)
+		assert.EqualValues(t, 1, n)
+		assert.Positive(t, replica.Latency())
+	}
+}
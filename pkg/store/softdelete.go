@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// ErrSoftDeleteUnsupported is returned by the soft-delete operations of a
+// Store whose model has neither a gorm.DeletedAt field nor a flag column set
+// with WithSoftDeleteFlag.
+var ErrSoftDeleteUnsupported = errors.New("model does not support soft delete")
+
+// deletedAtType is the type of the field used by GORM for soft deletes.
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// softDeleteFlag describes a column flagging soft-deleted objects.
+type softDeleteFlag struct {
+	column  string
+	deleted any
+	active  any
+}
+
+// WithSoftDeleteFlag returns an Option function that soft-deletes objects by
+// setting the given column to deleted, instead of using a gorm.DeletedAt
+// field. Objects whose column is not set to active are then ignored by Get,
+// List and ListCursor, and Delete soft-deletes objects.
+func WithSoftDeleteFlag[T any](column string, deleted, active any) Option[T] {
+	return func(s *Store[T]) {
+		s.softDeleteFlag = &softDeleteFlag{column: column, deleted: deleted, active: active}
+	}
+}
+
+// SoftDelete marks the objects matching the provided where options as deleted,
+// so that they are no longer returned by Get and List.
+func (s *Store[T]) SoftDelete(ctx context.Context, opts *where.Options) error {
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationDelete,
+		method:    "SoftDelete",
+		before:    s.selected(opts, s.activeScope),
+		run: func(ctx context.Context) error {
+			db := s.db(ctx, opts)
+
+			var err error
+			if s.softDeleteFlag != nil {
+				err = s.active(db).Model(new(T)).Update(s.softDeleteFlag.column, s.softDeleteFlag.deleted).Error
+			} else if _, ok := s.deletedAtColumn(db); ok {
+				err = db.Delete(new(T)).Error
+			} else {
+				err = ErrSoftDeleteUnsupported
+			}
+			if err != nil {
+				s.logger.Error(ctx, err, "Failed to soft-delete object from database", "conditions", opts)
+				return err
+			}
+			return nil
+		},
+	})
+}
+
+// Restore undeletes the soft-deleted objects matching the provided where options.
+func (s *Store[T]) Restore(ctx context.Context, opts *where.Options) error {
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationUpdate,
+		method:    "Restore",
+		before:    s.selected(opts, s.deleted),
+		run: func(ctx context.Context) error {
+			db, err := s.deleted(s.db(ctx, opts))
+			if err == nil {
+				if s.softDeleteFlag != nil {
+					err = db.Model(new(T)).Update(s.softDeleteFlag.column, s.softDeleteFlag.active).Error
+				} else {
+					column, _ := s.deletedAtColumn(db)
+					err = db.Model(new(T)).Update(column, nil).Error
+				}
+			}
+			if err != nil {
+				s.logger.Error(ctx, err, "Failed to restore object in database", "conditions", opts)
+				return err
+			}
+			return nil
+		},
+		after: s.reload,
+	})
+}
+
+// Purge permanently removes the soft-deleted objects matching the provided
+// where options. Objects which are not soft-deleted are left untouched.
+func (s *Store[T]) Purge(ctx context.Context, opts *where.Options) error {
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationDelete,
+		method:    "Purge",
+		before:    s.selected(opts, s.deleted),
+		run: func(ctx context.Context) error {
+			db, err := s.deleted(s.db(ctx, opts))
+			if err == nil {
+				err = db.Delete(new(T)).Error
+			}
+			if err != nil {
+				s.logger.Error(ctx, err, "Failed to purge object from database", "conditions", opts)
+				return err
+			}
+			return nil
+		},
+	})
+}
+
+// ListWithDeleted retrieves a list of objects, including the soft-deleted
+// ones, from the database based on the provided where options.
+func (s *Store[T]) ListWithDeleted(ctx context.Context, opts *where.Options) (count int64, ret []*T, err error) {
+	return s.list(ctx, s.readDB(ctx, "ListWithDeleted", opts).Unscoped(), opts)
+}
+
+// ListOnlyDeleted retrieves a list of the soft-deleted objects from the
+// database based on the provided where options.
+func (s *Store[T]) ListOnlyDeleted(ctx context.Context, opts *where.Options) (count int64, ret []*T, err error) {
+	db, err := s.deleted(s.readDB(ctx, "ListOnlyDeleted", opts))
+	if err != nil {
+		s.logger.Error(ctx, err, "Failed to list objects from database", "conditions", opts)
+		return 0, nil, err
+	}
+	return s.list(ctx, db, opts)
+}
+
+// active restricts db to the objects which are not soft-deleted with a flag
+// column. GORM does so by itself for gorm.DeletedAt fields.
+func (s *Store[T]) active(db *gorm.DB) *gorm.DB {
+	if s.softDeleteFlag == nil {
+		return db
+	}
+	return db.Where(clause.Eq{Column: clause.Column{Name: s.softDeleteFlag.column}, Value: s.softDeleteFlag.active})
+}
+
+// activeScope is active as a scope for selected.
+func (s *Store[T]) activeScope(db *gorm.DB) (*gorm.DB, error) {
+	return s.active(db), nil
+}
+
+// deleted restricts db to the soft-deleted objects.
+func (s *Store[T]) deleted(db *gorm.DB) (*gorm.DB, error) {
+	if s.softDeleteFlag != nil {
+		return db.Where(clause.Eq{Column: clause.Column{Name: s.softDeleteFlag.column}, Value: s.softDeleteFlag.deleted}), nil
+	}
+	if column, ok := s.deletedAtColumn(db); ok {
+		return db.Unscoped().Where(clause.Neq{Column: clause.Column{Name: column}, Value: nil}), nil
+	}
+	return nil, ErrSoftDeleteUnsupported
+}
+
+// deletedAtColumn returns the column of the gorm.DeletedAt field of T, if any.
+func (s *Store[T]) deletedAtColumn(db *gorm.DB) (string, bool) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return "", false
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field.DBName, true
+		}
+	}
+	return "", false
+}
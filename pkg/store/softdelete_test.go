@@ -0,0 +1,129 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type Post struct {
+	ID        int64
+	TenantID  string
+	Title     string
+	DeletedAt gorm.DeletedAt
+}
+
+type Comment struct {
+	ID       int64
+	TenantID string
+	Body     string
+	Deleted  bool
+}
+
+type tenantKey struct{}
+
+func init() {
+	where.RegisterTenant("tenant_id", func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	})
+}
+
+func titles(list []*Post) []string {
+	ret := make([]string, 0, len(list))
+	for _, post := range list {
+		ret = append(ret, post.Title)
+	}
+	return ret
+}
+
+func TestStore_SoftDelete_DeletedAt(t *testing.T) {
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Post{}))
+	posts := store.NewStore[Post](store.NewTxManager(db), nil)
+
+	a := context.WithValue(context.Background(), tenantKey{}, "a")
+	b := context.WithValue(context.Background(), tenantKey{}, "b")
+	for _, post := range []*Post{{TenantID: "a", Title: "a1"}, {TenantID: "a", Title: "a2"}, {TenantID: "b", Title: "b1"}} {
+		require.NoError(t, posts.Create(a, post))
+	}
+
+	// 只删除当前租户的记录
+	require.NoError(t, posts.SoftDelete(a, where.T(a)))
+	require.NoError(t, posts.Delete(b, where.T(b).F("title", "b1")))
+
+	count, _, err := posts.List(a, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, count)
+
+	_, list, err := posts.ListOnlyDeleted(a, where.T(a))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a1", "a2"}, titles(list))
+
+	// 恢复不影响其他租户的记录
+	require.NoError(t, posts.Restore(a, where.T(a).F("title", "a1")))
+	_, list, err = posts.List(a, where.NewWhere())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1"}, titles(list))
+
+	_, list, err = posts.ListWithDeleted(a, where.NewWhere())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a1", "a2", "b1"}, titles(list))
+
+	// 彻底删除只影响已软删除的记录
+	require.NoError(t, posts.Purge(a, where.T(a)))
+	_, list, err = posts.ListWithDeleted(a, where.NewWhere())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a1", "b1"}, titles(list))
+}
+
+func TestStore_SoftDelete_Flag(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Comment{}))
+	comments := store.NewStore[Comment](store.NewTxManager(db), nil, store.WithSoftDeleteFlag[Comment]("deleted", true, false))
+
+	for _, body := range []string{"x", "y", "z"} {
+		require.NoError(t, comments.Create(ctx, &Comment{TenantID: "a", Body: body}))
+	}
+
+	require.NoError(t, comments.Delete(ctx, where.F("body", "x")))
+	require.NoError(t, comments.SoftDelete(ctx, where.F("body", "y")))
+
+	_, err := comments.Get(ctx, where.F("body", "x"))
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	count, _, err := comments.List(ctx, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	count, _, err = comments.ListOnlyDeleted(ctx, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+
+	require.NoError(t, comments.Restore(ctx, where.F("body", "x")))
+	require.NoError(t, comments.Purge(ctx, where.NewWhere()))
+
+	count, list, err := comments.ListWithDeleted(ctx, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+	assert.False(t, list[0].Deleted)
+	assert.False(t, list[1].Deleted)
+}
+
+func TestStore_SoftDelete_Unsupported(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewStore[User](store.NewTxManager(newDB(t)), nil)
+
+	assert.ErrorIs(t, users.SoftDelete(ctx, where.F("id", 1)), store.ErrSoftDeleteUnsupported)
+	assert.ErrorIs(t, users.Restore(ctx, where.F("id", 1)), store.ErrSoftDeleteUnsupported)
+	assert.ErrorIs(t, users.Purge(ctx, where.F("id", 1)), store.ErrSoftDeleteUnsupported)
+	_, _, err := users.ListOnlyDeleted(ctx, where.NewWhere())
+	assert.ErrorIs(t, err, store.ErrSoftDeleteUnsupported)
+}
@@ -3,13 +3,20 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
 
 	"gorm.io/gorm"
 
 	"github.com/LiangNing7/goutils/pkg/store/logger/empty"
 	"github.com/LiangNing7/goutils/pkg/store/where"
+	"github.com/LiangNing7/goutils/pkg/util/pagination"
 )
 
+// ErrKeysetRequired is returned by ListCursor when the where options do not
+// set a keyset.
+var ErrKeysetRequired = errors.New("keyset pagination requires where.Options.Keyset")
+
 // DBProvider defines an interface for providing a database connection.
 type DBProvider interface {
 	// DB returns the database instance for the given context.
@@ -21,8 +28,13 @@ type Option[T any] func(*Store[T])
 
 // Store represents a generic data store with logging capabilities.
 type Store[T any] struct {
-	logger  Logger
-	storage DBProvider
+	logger         Logger
+	storage        DBProvider
+	softDeleteFlag *softDeleteFlag
+	optimisticLock bool
+	tenant         *where.Tenant
+	tenantAuditor  TenantAuditor
+	hooks          []Hook[T]
 }
 
 // WithLogger returns an Option function that sets the provided Logger to the Store for logging purposes.
@@ -33,20 +45,46 @@ func WithLogger[T any](logger Logger) Option[T] {
 }
 
 // NewStore creates a new instance of Store with the provided DBProvider.
-func NewStore[T any](storage DBProvider, logger Logger) *Store[T] {
+func NewStore[T any](storage DBProvider, logger Logger, opts ...Option[T]) *Store[T] {
 	if logger == nil {
 		logger = empty.NewLogger()
 	}
 
-	return &Store[T]{
+	s := &Store[T]{
 		logger:  logger,
 		storage: storage,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// db retrieves the database instance and applies the provided where conditions.
+// db retrieves the database instance, scoped to the tenant of ctx for
+// tenant-aware stores, and applies the provided where conditions.
+// The transaction carried by ctx, if any, takes precedence over the DBProvider.
 func (s *Store[T]) db(ctx context.Context, wheres ...where.Where) *gorm.DB {
-	dbInstance := s.storage.DB(ctx)
+	return s.scoped(ctx, "", wheres...)
+}
+
+// readDB is like db for the read operation with the given name. It uses the
+// ReadDB of ReadDBProviders, and may see all tenants, see WithCrossTenant.
+func (s *Store[T]) readDB(ctx context.Context, operation string, wheres ...where.Where) *gorm.DB {
+	return s.scoped(ctx, operation, wheres...)
+}
+
+// scoped implements db and readDB.
+func (s *Store[T]) scoped(ctx context.Context, operation string, wheres ...where.Where) *gorm.DB {
+	var dbInstance *gorm.DB
+	if provider, ok := s.storage.(ReadDBProvider); ok && operation != "" {
+		dbInstance = provider.ReadDB(ctx)
+	} else {
+		dbInstance = s.storage.DB(ctx)
+	}
+	if tx, ok := TxFromContext(ctx); ok {
+		dbInstance = tx.WithContext(ctx)
+	}
+	dbInstance = s.scopeTenant(ctx, dbInstance, operation)
 	for _, whr := range wheres {
 		if whr != nil {
 			dbInstance = whr.Where(dbInstance)
@@ -55,38 +93,91 @@ func (s *Store[T]) db(ctx context.Context, wheres ...where.Where) *gorm.DB {
 	return dbInstance
 }
 
-// Create inserts a new object into the database.
+// Create inserts a new object into the database. Tenant-aware stores set its
+// tenant column to the tenant of ctx.
 func (s *Store[T]) Create(ctx context.Context, obj *T) error {
-	if err := s.db(ctx).Create(obj).Error; err != nil {
-		s.logger.Error(ctx, err, "Failed to insert object into database", "object", obj)
-		return err
-	}
-	return nil
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationCreate,
+		method:    "Create",
+		run: func(ctx context.Context) error {
+			db := s.db(ctx)
+			err := s.stampTenant(ctx, db, obj)
+			if err == nil {
+				err = db.Create(obj).Error
+			}
+			if err != nil {
+				s.logger.Error(ctx, err, "Failed to insert object into database", "object", obj)
+				return err
+			}
+			return nil
+		},
+		after: objects(obj),
+	})
 }
 
-// Update modifies an existing object in the database.
+// Update modifies an existing object in the database. With optimistic locking
+// enabled, it returns a ConflictError if the object has been modified since it
+// was read, see WithOptimisticLock. Tenant-aware stores only update objects of
+// the tenant of ctx, and return gorm.ErrRecordNotFound for other objects.
 func (s *Store[T]) Update(ctx context.Context, obj *T) error {
-	if err := s.db(ctx).Save(obj).Error; err != nil {
-		s.logger.Error(ctx, err, "Failed to update object in database", "object", obj)
-		return err
-	}
-	return nil
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationUpdate,
+		method:    "Update",
+		before:    s.current(obj),
+		run: func(ctx context.Context) error {
+			db := s.db(ctx)
+			err := s.stampTenant(ctx, db, obj)
+			switch {
+			case err != nil:
+			case s.optimisticLock:
+				err = s.updateVersioned(ctx, db, obj, nil)
+			case s.tenant != nil:
+				// Save inserts objects which do not match, possibly in another tenant
+				err = s.updateScoped(ctx, db, obj)
+			default:
+				err = db.Save(obj).Error
+			}
+			if err != nil {
+				s.logger.Error(ctx, err, "Failed to update object in database", "object", obj)
+				return err
+			}
+			return nil
+		},
+		after: s.reloaded(obj),
+	})
 }
 
 // Delete removes an object from the database based on the provided where options.
+// Objects of soft-deletable models are soft-deleted, see SoftDelete.
 func (s *Store[T]) Delete(ctx context.Context, opts *where.Options) error {
-	err := s.db(ctx, opts).Delete(new(T)).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		s.logger.Error(ctx, err, "Failed to delete object from database", "conditions", opts)
-		return err
+	if s.softDeleteFlag != nil {
+		return s.SoftDelete(ctx, opts)
 	}
-	return nil
+
+	return s.mutate(ctx, mutation[T]{
+		operation: OperationDelete,
+		method:    "Delete",
+		before:    s.selected(opts, unrestricted),
+		run: func(ctx context.Context) error {
+			err := s.db(ctx, opts).Delete(new(T)).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				s.logger.Error(ctx, err, "Failed to delete object from database", "conditions", opts)
+				return err
+			}
+			return nil
+		},
+	})
 }
 
 // Get retrieves a single object from the database based on the provided where options.
 func (s *Store[T]) Get(ctx context.Context, opts *where.Options) (*T, error) {
+	return s.first(ctx, s.active(s.readDB(ctx, "Get", opts)), opts)
+}
+
+// first retrieves the first object selected by db.
+func (s *Store[T]) first(ctx context.Context, db *gorm.DB, opts *where.Options) (*T, error) {
 	var obj T
-	if err := s.db(ctx, opts).First(&obj).Error; err != nil {
+	if err := db.First(&obj).Error; err != nil {
 		s.logger.Error(ctx, err, "Failed to retrieve object from database", "conditions", opts)
 		return nil, err
 	}
@@ -94,10 +185,68 @@ func (s *Store[T]) Get(ctx context.Context, opts *where.Options) (*T, error) {
 }
 
 // List retrieves a list of objects from the database based on the provided where options.
+// Objects are sorted by descending ID, unless the options set an order or a keyset.
+// List keeps its signature for compatibility with existing callers, and does
+// not return the cursor of the next page: use ListCursor for keyset
+// pagination, which also saves counting the objects.
 func (s *Store[T]) List(ctx context.Context, opts *where.Options) (count int64, ret []*T, err error) {
-	err = s.db(ctx, opts).Order("id desc").Find(&ret).Offset(-1).Limit(-1).Count(&count).Error
+	return s.list(ctx, s.active(s.readDB(ctx, "List", opts)), opts)
+}
+
+// list retrieves the objects selected by db and counts them.
+func (s *Store[T]) list(ctx context.Context, db *gorm.DB, opts *where.Options) (count int64, ret []*T, err error) {
+	if opts == nil || !opts.Ordered() {
+		db = db.Order("id desc")
+	}
+	err = db.Find(&ret).Offset(-1).Limit(-1).Count(&count).Error
 	if err != nil {
 		s.logger.Error(ctx, err, "Failed to list objects from database", "conditions", opts)
 	}
 	return
 }
+
+// ListCursor retrieves a page of objects using keyset pagination, as set by
+// where.Options.Keyset. Unlike List, it does not count the objects, since
+// counting scans the whole table which keyset pagination avoids. nextCursor is
+// the cursor of the next page, or empty if this is the last page.
+func (s *Store[T]) ListCursor(ctx context.Context, opts *where.Options) (ret []*T, nextCursor string, err error) {
+	if opts == nil || opts.Keyset == nil {
+		return nil, "", ErrKeysetRequired
+	}
+
+	// Fetch one more object to tell whether there is a next page
+	db := s.active(s.readDB(ctx, "ListCursor", opts))
+	if opts.Limit > 0 {
+		db = db.Limit(opts.Limit + 1)
+	}
+	db = db.Find(&ret)
+	if err = db.Error; err != nil {
+		s.logger.Error(ctx, err, "Failed to list objects from database", "conditions", opts)
+		return nil, "", err
+	}
+	if opts.Limit <= 0 || len(ret) <= opts.Limit {
+		return ret, "", nil
+	}
+
+	ret = ret[:opts.Limit]
+	if nextCursor, err = s.cursor(ctx, db, opts.Keyset, ret[len(ret)-1]); err != nil {
+		s.logger.Error(ctx, err, "Failed to encode cursor", "conditions", opts)
+		return nil, "", err
+	}
+	return ret, nextCursor, nil
+}
+
+// cursor encodes the position of obj in the keyset order.
+func (s *Store[T]) cursor(ctx context.Context, db *gorm.DB, keyset *where.Keyset, obj *T) (string, error) {
+	columns := keyset.Columns()
+	values := make([]any, 0, len(columns))
+	for _, column := range columns {
+		field := db.Statement.Schema.LookUpField(column)
+		if field == nil {
+			return "", fmt.Errorf("unknown keyset column %q", column)
+		}
+		value, _ := field.ValueOf(ctx, reflect.ValueOf(obj))
+		values = append(values, value)
+	}
+	return pagination.EncodeCursor(values...)
+}
@@ -0,0 +1,105 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+func TestStore_ListCursor(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewStore[User](store.NewTxManager(newDB(t)), nil)
+	for _, name := range []string{"b", "a", "c", "a", "b"} {
+		require.NoError(t, users.Create(ctx, &User{Name: name}))
+	}
+
+	// 按 name 升序翻页，name 相同时按 id 排序
+	var names []string
+	var ids []int64
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+
+		list, next, err := users.ListCursor(ctx, where.L(2).K(where.Keyset{Column: "name", Cursor: cursor}))
+		require.NoError(t, err)
+		for _, user := range list {
+			names = append(names, user.Name)
+			ids = append(ids, user.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, []string{"a", "a", "b", "b", "c"}, names)
+	assert.Equal(t, []int64{2, 4, 1, 5, 3}, ids)
+
+	// 降序
+	list, next, err := users.ListCursor(ctx, where.L(3).K(where.Keyset{Desc: true}))
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.EqualValues(t, 5, list[0].ID)
+
+	list, next, err = users.ListCursor(ctx, where.L(3).K(where.Keyset{Desc: true, Cursor: next}))
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, list, 2)
+	assert.EqualValues(t, 2, list[0].ID)
+}
+
+func TestStore_ListCursor_Invalid(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewStore[User](store.NewTxManager(newDB(t)), nil)
+
+	_, _, err := users.ListCursor(ctx, where.L(2))
+	assert.ErrorIs(t, err, store.ErrKeysetRequired)
+
+	_, _, err = users.ListCursor(ctx, where.L(2).K(where.Keyset{Cursor: "not a cursor"}))
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+}
+
+func TestStore_ListOrder(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewStore[User](store.NewTxManager(newDB(t)), nil)
+	for _, name := range []string{"b", "a", "c", "a"} {
+		require.NoError(t, users.Create(ctx, &User{Name: name}))
+	}
+
+	ids := func(list []*User) []int64 {
+		ret := make([]int64, 0, len(list))
+		for _, user := range list {
+			ret = append(ret, user.ID)
+		}
+		return ret
+	}
+
+	// 未指定排序时按 id 降序
+	count, list, err := users.List(ctx, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+	assert.Equal(t, []int64{4, 3, 2, 1}, ids(list))
+
+	// 多列排序
+	count, list, err = users.List(ctx, where.S("name", false).S("id", true).L(3))
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+	assert.Equal(t, []int64{4, 2, 1}, ids(list))
+
+	_, list, err = users.List(ctx, where.NewWhere(where.WithOrder("name", true), where.WithOrderAllowlist("name")))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 1}, ids(list)[:2])
+
+	// 非法的列名和不在白名单中的列被拒绝
+	_, _, err = users.List(ctx, where.S("name; DROP TABLE users", false))
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+	_, _, err = users.List(ctx, where.S("id", false).A("name"))
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+	_, _, err = users.ListCursor(ctx, where.K(where.Keyset{Column: "name"}).A("created_at"))
+	assert.ErrorIs(t, err, errorsx.ErrInvalidArgument)
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/LiangNing7/goutils/pkg/log"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// ErrTenantRequired is returned by the operations of a tenant-aware Store
+// when the context carries no tenant.
+var ErrTenantRequired = errors.New("tenant is required")
+
+// crossTenantKey is the context key under which WithCrossTenant stores the reason.
+type crossTenantKey struct{}
+
+// TenantAuditor records the reads of a tenant-aware Store which cross tenants.
+// model is the name of the model, operation the name of the Store method.
+type TenantAuditor func(ctx context.Context, model, operation, reason string)
+
+// WithTenant returns an Option function that makes the Store tenant-aware.
+// Every query, update and delete is then scoped to the tenant returned by
+// tenant.ValueFunc for the context, stored in the tenant.Key column, and
+// creates set that column. Operations fail with ErrTenantRequired when the
+// context carries no tenant.
+func WithTenant[T any](tenant where.Tenant) Option[T] {
+	return func(s *Store[T]) {
+		s.tenant = &tenant
+	}
+}
+
+// WithTenantAuditor returns an Option function that sets the auditor called
+// on cross-tenant reads. By default they are logged with the log package.
+func WithTenantAuditor[T any](auditor TenantAuditor) Option[T] {
+	return func(s *Store[T]) {
+		s.tenantAuditor = auditor
+	}
+}
+
+// WithCrossTenant returns a copy of ctx with which the reads (Get and the List
+// methods) of tenant-aware stores see the objects of all tenants, e.g. for
+// administration. Every such read is recorded by the TenantAuditor of the
+// store with the given reason, which must not be empty. Writes remain scoped
+// to the tenant of ctx.
+func WithCrossTenant(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, crossTenantKey{}, reason)
+}
+
+// crossTenantReason returns the reason given to WithCrossTenant, if any.
+func crossTenantReason(ctx context.Context) string {
+	reason, _ := ctx.Value(crossTenantKey{}).(string)
+	return reason
+}
+
+// defaultTenantAuditor logs cross-tenant reads.
+func defaultTenantAuditor(ctx context.Context, model, operation, reason string) {
+	log.Infow("Cross-tenant read", "model", model, "operation", operation, "reason", reason)
+}
+
+// scopeTenant restricts db to the tenant of ctx. Reads, for which operation is
+// not empty, see all tenants if ctx was created by WithCrossTenant.
+func (s *Store[T]) scopeTenant(ctx context.Context, db *gorm.DB, operation string) *gorm.DB {
+	if s.tenant == nil {
+		return db
+	}
+
+	if reason := crossTenantReason(ctx); operation != "" && reason != "" {
+		auditor := s.tenantAuditor
+		if auditor == nil {
+			auditor = defaultTenantAuditor
+		}
+		auditor(ctx, reflect.TypeFor[T]().Name(), operation, reason)
+		return db
+	}
+
+	tenant := s.tenant.ValueFunc(ctx)
+	if tenant == "" {
+		_ = db.AddError(ErrTenantRequired)
+		return db
+	}
+	return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: s.tenant.Key}, Value: tenant})
+}
+
+// stampTenant sets the tenant column of the objects to the tenant of ctx.
+func (s *Store[T]) stampTenant(ctx context.Context, db *gorm.DB, objs ...*T) error {
+	if s.tenant == nil {
+		return nil
+	}
+
+	tenant := s.tenant.ValueFunc(ctx)
+	if tenant == "" {
+		return ErrTenantRequired
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return err
+	}
+	field := stmt.Schema.LookUpField(s.tenant.Key)
+	if field == nil {
+		return fmt.Errorf("model %s has no tenant column %q", stmt.Schema.Name, s.tenant.Key)
+	}
+	for _, obj := range objs {
+		if err := field.Set(ctx, reflect.ValueOf(obj), tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unscopedColumns returns the columns to update without the tenant column, so
+// that objects cannot be moved to another tenant. The given map is left
+// unchanged, since it may belong to the caller.
+func (s *Store[T]) unscopedColumns(columns map[string]any) map[string]any {
+	if s.tenant == nil {
+		return columns
+	}
+	if _, ok := columns[s.tenant.Key]; !ok {
+		return columns
+	}
+
+	columns = maps.Clone(columns)
+	delete(columns, s.tenant.Key)
+	return columns
+}
+
+// updateScoped updates all columns of obj, which must exist in the scope of db.
+// Unlike Save, it never inserts obj.
+func (s *Store[T]) updateScoped(ctx context.Context, db *gorm.DB, obj *T) error {
+	if err := requirePrimaryKey(ctx, db, obj); err != nil {
+		return err
+	}
+
+	result := db.Model(obj).Select("*").Updates(obj)
+	if result.Error != nil {
+		return result.Error
+	}
+	return s.requireUpdated(ctx, result, obj)
+}
+
+// requireUpdated returns gorm.ErrRecordNotFound if the update whose result is
+// given matched no row. MySQL only counts the rows whose values changed, so
+// when no row is affected, obj is looked up in the scope of the store to tell
+// an update which changed nothing from one which matched nothing.
+func (s *Store[T]) requireUpdated(ctx context.Context, result *gorm.DB, obj *T) error {
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	stmt := &gorm.Statement{DB: result}
+	if err := stmt.Parse(obj); err != nil {
+		return err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	value, _ := pk.ValueOf(ctx, reflect.ValueOf(obj))
+
+	var count int64
+	err := s.db(ctx).Model(new(T)).
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: value}).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// requirePrimaryKey returns an error unless obj has a primary key.
+func requirePrimaryKey(ctx context.Context, db *gorm.DB, obj any) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(obj); err != nil {
+		return err
+	}
+
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("model %s has no primary key", stmt.Schema.Name)
+	}
+	if _, zero := pk.ValueOf(ctx, reflect.ValueOf(obj)); zero {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	return nil
+}
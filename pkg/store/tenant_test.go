@@ -0,0 +1,214 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// audit 记录跨租户读取.
+type audit struct {
+	operations []string
+	reasons    []string
+}
+
+func (a *audit) record(ctx context.Context, model, operation, reason string) {
+	a.operations = append(a.operations, model+"."+operation)
+	a.reasons = append(a.reasons, reason)
+}
+
+func newTenantStore(t *testing.T, opts ...store.Option[Post]) *store.Store[Post] {
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Post{}))
+	tenant := where.Tenant{Key: "tenant_id", ValueFunc: func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	}}
+	return store.NewStore[Post](store.NewTxManager(db), nil, append(opts, store.WithTenant[Post](tenant))...)
+}
+
+func TestStore_Tenant(t *testing.T) {
+	posts := newTenantStore(t)
+	a := context.WithValue(context.Background(), tenantKey{}, "a")
+	b := context.WithValue(context.Background(), tenantKey{}, "b")
+
+	// 创建时自动写入租户, 忽略调用方设置的值
+	a1 := &Post{TenantID: "b", Title: "a1"}
+	require.NoError(t, posts.Create(a, a1))
+	assert.Equal(t, "a", a1.TenantID)
+	_, err := posts.CreateInBatches(b, []*Post{{Title: "b1"}, {Title: "b2"}}, 0)
+	require.NoError(t, err)
+
+	// 查询只返回当前租户的记录, 无需 where.T
+	count, list, err := posts.List(a, where.NewWhere())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	assert.Equal(t, []string{"a1"}, titles(list))
+
+	_, err = posts.Get(b, where.F("id", a1.ID))
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// 其他租户无法更新或删除记录
+	err = posts.Update(b, &Post{ID: a1.ID, Title: "hijacked"})
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	err = posts.UpdateFields(b, &Post{ID: a1.ID, Title: "hijacked"}, store.FieldPaths{"title"})
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	n, err := posts.BatchUpdate(b, where.F("id", a1.ID), map[string]any{"title": "hijacked"})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.NoError(t, posts.Delete(b, where.F("id", a1.ID)))
+
+	got, err := posts.Get(a, where.F("id", a1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "a1", got.Title)
+
+	// 更新不能把记录移到其他租户
+	require.NoError(t, posts.Update(a, &Post{ID: a1.ID, TenantID: "b", Title: "a1'"}))
+	columns := map[string]any{"tenant_id": "b"}
+	_, err = posts.BatchUpdate(a, where.NewWhere(), columns)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"tenant_id": "b"}, columns) // 调用方的 map 保持不变
+	got, err = posts.Get(a, where.F("id", a1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.TenantID)
+	assert.Equal(t, "a1'", got.Title)
+
+	// Upsert 不会覆盖其他租户的记录
+	_, err = posts.Upsert(b, []*Post{{ID: a1.ID, Title: "hijacked"}}, nil, nil)
+	require.NoError(t, err)
+	got, err = posts.Get(a, where.F("id", a1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "a1'", got.Title)
+}
+
+func TestStore_Tenant_Required(t *testing.T) {
+	posts := newTenantStore(t)
+	ctx := context.Background()
+
+	require.ErrorIs(t, posts.Create(ctx, &Post{Title: "x"}), store.ErrTenantRequired)
+	_, _, err := posts.List(ctx, where.NewWhere())
+	require.ErrorIs(t, err, store.ErrTenantRequired)
+	require.ErrorIs(t, posts.Delete(ctx, where.F("id", 1)), store.ErrTenantRequired)
+
+	// 跨租户读取不允许写入
+	admin := store.WithCrossTenant(ctx, "support ticket")
+	require.ErrorIs(t, posts.Delete(admin, where.NewWhere()), store.ErrTenantRequired)
+}
+
+func TestStore_Tenant_CrossTenant(t *testing.T) {
+	auditor := &audit{}
+	posts := newTenantStore(t, store.WithTenantAuditor[Post](auditor.record))
+	a := context.WithValue(context.Background(), tenantKey{}, "a")
+	b := context.WithValue(context.Background(), tenantKey{}, "b")
+	require.NoError(t, posts.Create(a, &Post{Title: "a1"}))
+	require.NoError(t, posts.Create(b, &Post{Title: "b1"}))
+
+	_, list, err := posts.List(a, where.NewWhere())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1"}, titles(list))
+	assert.Empty(t, auditor.operations)
+
+	admin := store.WithCrossTenant(a, "billing report")
+	_, list, err = posts.List(admin, where.NewWhere())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a1", "b1"}, titles(list))
+	_, err = posts.Get(admin, where.F("title", "b1"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Post.List", "Post.Get"}, auditor.operations)
+	assert.Equal(t, []string{"billing report", "billing report"}, auditor.reasons)
+
+	// 写入仍限定在 ctx 的租户
+	require.NoError(t, posts.Delete(admin, where.F("title", "b1")))
+	_, err = posts.Get(b, where.F("title", "b1"))
+	require.NoError(t, err)
+}
+
+// statements 记录执行的 SQL 语句.
+type statements struct {
+	logger.Interface
+	sqls []string
+}
+
+func (s *statements) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	s.sqls = append(s.sqls, sql)
+}
+
+func TestStore_Tenant_UpsertMySQL(t *testing.T) {
+	// MySQL 忽略 ON DUPLICATE KEY UPDATE 的 WHERE 条件, 只在生成的 SQL 中检查租户限制
+	recorder := &statements{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	require.NoError(t, err)
+	tenant := where.Tenant{Key: "tenant_id", ValueFunc: func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	}}
+	posts := store.NewStore[Post](store.NewTxManager(db), nil, store.WithTenant[Post](tenant))
+	b := context.WithValue(context.Background(), tenantKey{}, "b")
+
+	_, err = posts.Upsert(b, []*Post{{ID: 1, Title: "hijacked"}}, nil, nil)
+	require.NoError(t, err)
+	_, err = posts.Upsert(b, []*Post{{ID: 1, Title: "hijacked"}}, nil, []string{"tenant_id", "title"})
+	require.NoError(t, err)
+	require.Len(t, recorder.sqls, 2)
+	for _, sql := range recorder.sqls {
+		assert.Contains(t, sql, "ON DUPLICATE KEY UPDATE `title`=IF(`posts`.`tenant_id` = 'b', VALUES(`title`), `title`)")
+		assert.NotContains(t, sql, "`tenant_id`=")
+	}
+}
+
+func TestStore_Tenant_UpsertColumns(t *testing.T) {
+	posts := newTenantStore(t)
+	a := context.WithValue(context.Background(), tenantKey{}, "a")
+	b := context.WithValue(context.Background(), tenantKey{}, "b")
+	a1 := &Post{Title: "a1"}
+	require.NoError(t, posts.Create(a, a1))
+
+	// 显式列出租户列时也不会更新租户
+	_, err := posts.Upsert(b, []*Post{{ID: a1.ID, Title: "hijacked"}}, nil, []string{"tenant_id", "title"})
+	require.NoError(t, err)
+	_, err = posts.Upsert(a, []*Post{{ID: a1.ID, Title: "a1'"}}, nil, []string{"tenant_id", "title"})
+	require.NoError(t, err)
+	got, err := posts.Get(a, where.F("id", a1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.TenantID)
+	assert.Equal(t, "a1'", got.Title)
+}
+
+func TestStore_Tenant_UpdateUnchanged(t *testing.T) {
+	db := newDB(t)
+	require.NoError(t, db.AutoMigrate(&Post{}))
+	changedRowsOnly(t, db)
+	tenant := where.Tenant{Key: "tenant_id", ValueFunc: func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	}}
+	posts := store.NewStore[Post](store.NewTxManager(db), nil, store.WithTenant[Post](tenant))
+	a := context.WithValue(context.Background(), tenantKey{}, "a")
+	b := context.WithValue(context.Background(), tenantKey{}, "b")
+
+	a1 := &Post{Title: "a1"}
+	require.NoError(t, posts.Create(a, a1))
+
+	// 保存没有变化的记录成功, 其他租户的更新仍然报告记录不存在
+	require.NoError(t, posts.Update(a, &Post{ID: a1.ID, Title: "a1"}))
+	err := posts.Update(b, &Post{ID: a1.ID, Title: "a1"})
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	err = posts.UpdateFields(b, &Post{ID: a1.ID, Title: "a1"}, store.FieldPaths{"title"})
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+// txKey is the context key under which RunInTx stores the transaction.
+type txKey struct{}
+
+// commitHooksKey is the context key under which RunInTx stores the functions
+// registered by AfterCommit.
+type commitHooksKey struct{}
+
+// commitHooks are the functions to run once a transaction is committed.
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func(ctx context.Context)
+}
+
+// add registers fn.
+func (h *commitHooks) add(fns ...func(ctx context.Context)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fns...)
+}
+
+// TxManager runs functions in database transactions. The transaction is
+// carried by the context passed to the function, and every Store[T] called
+// with that context runs its queries in it, whatever its DBProvider.
+type TxManager struct {
+	db       *gorm.DB
+	replicas Replicas
+}
+
+// TxManagerOption defines a function type for configuring the TxManager.
+type TxManagerOption func(*TxManager)
+
+// Ensure TxManager implements the DBProvider interface.
+var _ DBProvider = (*TxManager)(nil)
+
+// NewTxManager creates a new TxManager instance starting its transactions on
+// the given database. The TxManager is also a DBProvider, so it can be passed
+// to NewStore as is.
+func NewTxManager(db *gorm.DB, opts ...TxManagerOption) *TxManager {
+	m := &TxManager{db: db}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// DB implements DBProvider. It returns the transaction of ctx if there is one,
+// and the database otherwise.
+func (m *TxManager) DB(ctx context.Context, wheres ...where.Where) *gorm.DB {
+	db, ok := TxFromContext(ctx)
+	if !ok {
+		db = m.db
+	}
+
+	db = db.WithContext(ctx)
+	for _, whr := range wheres {
+		if whr != nil {
+			db = whr.Where(db)
+		}
+	}
+	return db
+}
+
+// RunInTx runs fn in a transaction, which is committed if fn returns nil and
+// rolled back if it returns an error or panics. The panic is propagated after
+// the rollback. When ctx already carries a transaction, fn runs in a savepoint
+// of it instead, so that only the changes made by fn are rolled back on error.
+func (m *TxManager) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	hooks := &commitHooks{}
+	err := m.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(WithTx(context.WithValue(ctx, commitHooksKey{}, hooks), tx))
+	})
+	if err != nil {
+		return err
+	}
+
+	// The functions registered in a savepoint run once the transaction is committed
+	if parent, ok := ctx.Value(commitHooksKey{}).(*commitHooks); ok {
+		if _, inTx := TxFromContext(ctx); inTx {
+			parent.add(hooks.fns...)
+			return nil
+		}
+	}
+	for _, fn := range hooks.fns {
+		fn(ctx)
+	}
+	return nil
+}
+
+// AfterCommit registers fn to be run once the transaction carried by ctx is
+// committed, or immediately if ctx carries no transaction. fn is not run if
+// the transaction, or the savepoint in which AfterCommit is called, is rolled
+// back. Transactions not started by RunInTx are considered committed.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if _, inTx := TxFromContext(ctx); !inTx || !ok {
+		fn(ctx)
+		return
+	}
+	hooks.add(fn)
+}
+
+// WithTx returns a copy of ctx carrying the given transaction.
+func WithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx, if any.
+func TxFromContext(ctx context.Context) (*gorm.DB, bool) {
+	tx, ok := ctx.Value(txKey{}).(*gorm.DB)
+	return tx, ok && tx != nil
+}
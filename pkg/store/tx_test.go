@@ -0,0 +1,152 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/LiangNing7/goutils/pkg/db/dbtest"
+	"github.com/LiangNing7/goutils/pkg/store"
+	"github.com/LiangNing7/goutils/pkg/store/where"
+)
+
+type User struct {
+	ID   int64
+	Name string
+}
+
+type Order struct {
+	ID     int64
+	UserID int64
+}
+
+// provider 是一个不感知事务的 DBProvider.
+type provider struct {
+	db *gorm.DB
+}
+
+func (p *provider) DB(ctx context.Context, wheres ...where.Where) *gorm.DB {
+	return p.db.WithContext(ctx)
+}
+
+func newDB(t *testing.T) *gorm.DB {
+	return dbtest.NewSQLite(t, nil, &User{}, &Order{})
+}
+
+func count[T any](t *testing.T, s *store.Store[T]) int64 {
+	n, _, err := s.List(context.Background(), where.NewWhere())
+	require.NoError(t, err)
+	return n
+}
+
+func TestTxManager_RunInTx(t *testing.T) {
+	ctx := context.Background()
+	db := newDB(t)
+	txm := store.NewTxManager(db)
+	users := store.NewStore[User](txm, nil)
+	orders := store.NewStore[Order](&provider{db: db}, nil)
+
+	// 两个 Store 在同一个事务中提交
+	err := txm.RunInTx(ctx, func(ctx context.Context) error {
+		user := &User{Name: "alice"}
+		if err := users.Create(ctx, user); err != nil {
+			return err
+		}
+		return orders.Create(ctx, &Order{UserID: user.ID})
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count(t, users))
+	assert.EqualValues(t, 1, count(t, orders))
+
+	// 返回错误时整体回滚
+	errAbort := errors.New("abort")
+	err = txm.RunInTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, users.Create(ctx, &User{Name: "bob"}))
+		require.NoError(t, orders.Create(ctx, &Order{UserID: 2}))
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+	assert.EqualValues(t, 1, count(t, users))
+	assert.EqualValues(t, 1, count(t, orders))
+
+	// panic 时回滚并继续向上传播
+	assert.Panics(t, func() {
+		_ = txm.RunInTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, users.Create(ctx, &User{Name: "carol"}))
+			panic("boom")
+		})
+	})
+	assert.EqualValues(t, 1, count(t, users))
+}
+
+func TestTxManager_Savepoint(t *testing.T) {
+	ctx := context.Background()
+	txm := store.NewTxManager(newDB(t))
+	users := store.NewStore[User](txm, nil)
+
+	errAbort := errors.New("abort")
+	err := txm.RunInTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, users.Create(ctx, &User{Name: "alice"}))
+
+		// 嵌套事务失败只回滚到保存点
+		err := txm.RunInTx(ctx, func(ctx context.Context) error {
+			require.NoError(t, users.Create(ctx, &User{Name: "bob"}))
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		return txm.RunInTx(ctx, func(ctx context.Context) error {
+			return users.Create(ctx, &User{Name: "carol"})
+		})
+	})
+	require.NoError(t, err)
+
+	_, list, err := users.List(ctx, where.NewWhere())
+	require.NoError(t, err)
+	names := make([]string, 0, len(list))
+	for _, user := range list {
+		names = append(names, user.Name)
+	}
+	assert.ElementsMatch(t, []string{"alice", "carol"}, names)
+}
+
+func TestAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	txm := store.NewTxManager(newDB(t))
+
+	var ran []string
+	record := func(name string) func(context.Context) {
+		return func(context.Context) { ran = append(ran, name) }
+	}
+
+	// 没有事务时立即执行
+	store.AfterCommit(ctx, record("no tx"))
+	assert.Equal(t, []string{"no tx"}, ran)
+
+	err := txm.RunInTx(ctx, func(ctx context.Context) error {
+		store.AfterCommit(ctx, record("outer"))
+		_ = txm.RunInTx(ctx, func(ctx context.Context) error {
+			store.AfterCommit(ctx, record("rolled back"))
+			return errors.New("rollback")
+		})
+		require.NoError(t, txm.RunInTx(ctx, func(ctx context.Context) error {
+			store.AfterCommit(ctx, record("savepoint"))
+			return nil
+		}))
+		// 提交前不执行
+		assert.Equal(t, []string{"no tx"}, ran)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"no tx", "outer", "savepoint"}, ran)
+
+	_ = txm.RunInTx(ctx, func(ctx context.Context) error {
+		store.AfterCommit(ctx, record("rolled back"))
+		return errors.New("rollback")
+	})
+	assert.Equal(t, []string{"no tx", "outer", "savepoint"}, ran)
+}
@@ -2,14 +2,23 @@ package where
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"slices"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/util/pagination"
 )
 
 const (
 	// defaultLimit 定义了分页查询时的默认最大记录数.
 	defaultLimit = -1
+
+	// defaultTieBreaker 定义了键集分页时默认的唯一列.
+	defaultTieBreaker = "id"
 )
 
 // Tenant 表示一个租户，包含用于获取其值的键和值获取函数.
@@ -32,6 +41,79 @@ type Query struct {
 	Args []any
 }
 
+// columnPattern 匹配合法的列名，可以带有表名前缀.
+var columnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Order 表示一个排序列.
+type Order struct {
+	// Column 为排序的列名.
+	Column string
+	// Desc 表示是否按降序排序.
+	Desc bool
+}
+
+// Keyset 定义了键集（游标）分页的参数.
+// 记录按 Column 和 TieBreaker 排序，Cursor 为上一页返回的游标，为空时从第一页开始.
+type Keyset struct {
+	// Column 为排序列，为空时只按 TieBreaker 排序.
+	Column string
+	// TieBreaker 为值唯一的列，用于在 Column 相同时确定顺序，默认为 "id".
+	TieBreaker string
+	// Desc 表示是否按降序排序.
+	Desc bool
+	// Cursor 为 pagination.EncodeCursor 编码的上一页最后一条记录的位置.
+	Cursor string
+}
+
+// Columns 返回键集分页依次使用的排序列.
+func (k *Keyset) Columns() []string {
+	tieBreaker := k.TieBreaker
+	if tieBreaker == "" {
+		tieBreaker = defaultTieBreaker
+	}
+	if k.Column == "" || k.Column == tieBreaker {
+		return []string{tieBreaker}
+	}
+	return []string{k.Column, tieBreaker}
+}
+
+// Where 按键集排序，并只保留游标之后的记录.
+func (k *Keyset) Where(db *gorm.DB) *gorm.DB {
+	columns := k.Columns()
+	for _, column := range columns {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: k.Desc})
+	}
+	if k.Cursor == "" {
+		return db
+	}
+
+	values, err := pagination.DecodeCursor(k.Cursor)
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	if len(values) != len(columns) {
+		_ = db.AddError(fmt.Errorf("cursor has %d values, %d expected", len(values), len(columns)))
+		return db
+	}
+
+	// (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ...，降序时使用 <.
+	var conds []clause.Expression
+	for i, column := range columns {
+		exprs := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Name: columns[j]}, Value: values[j]})
+		}
+		if k.Desc {
+			exprs = append(exprs, clause.Lt{Column: clause.Column{Name: column}, Value: values[i]})
+		} else {
+			exprs = append(exprs, clause.Gt{Column: clause.Column{Name: column}, Value: values[i]})
+		}
+		conds = append(conds, clause.And(exprs...))
+	}
+	return db.Where(clause.Or(conds...))
+}
+
 // Option 定义了一个函数类型，用于修改 Options 对象.
 type Option func(*Options)
 
@@ -47,6 +129,13 @@ type Options struct {
 	Clauses []clause.Expression
 	// Queries 存放多个额外的查询条件.
 	Queries []Query
+	// Keyset 存放键集分页参数，设置后忽略 Offset 和 Orders.
+	Keyset *Keyset
+	// Orders 存放按顺序应用的排序列.
+	Orders []Order
+	// OrderAllowlist 存放允许排序的列，为空时允许任意合法的列名.
+	// 排序列来自用户输入时，应通过它限制可排序的列.
+	OrderAllowlist []string
 }
 
 // registeredTenant 持有全局注册的 Tenant 信息.
@@ -107,6 +196,27 @@ func WithQuery(query any, args ...any) Option {
 	}
 }
 
+// WithOrder 创建一个追加排序列的 Option，可以多次使用以按多列排序.
+func WithOrder(column string, desc bool) Option {
+	return func(whr *Options) {
+		whr.Orders = append(whr.Orders, Order{Column: column, Desc: desc})
+	}
+}
+
+// WithOrderAllowlist 创建一个设置允许排序的列的 Option.
+func WithOrderAllowlist(columns ...string) Option {
+	return func(whr *Options) {
+		whr.OrderAllowlist = columns
+	}
+}
+
+// WithKeyset 创建一个使用键集分页的 Option.
+func WithKeyset(keyset Keyset) Option {
+	return func(whr *Options) {
+		whr.Keyset = &keyset
+	}
+}
+
 // NewWhere 根据传入的 Option 构造并返回一个初始化号的 Options 实例.
 func NewWhere(opts ...Option) *Options {
 	whr := &Options{
@@ -164,6 +274,29 @@ func (whr *Options) Q(query any, args ...any) *Options {
 	return whr
 }
 
+// S 追加一个排序列并返回自身，多次调用时按调用顺序排序.
+func (whr *Options) S(column string, desc bool) *Options {
+	whr.Orders = append(whr.Orders, Order{Column: column, Desc: desc})
+	return whr
+}
+
+// A 设置允许排序的列并返回自身.
+func (whr *Options) A(columns ...string) *Options {
+	whr.OrderAllowlist = columns
+	return whr
+}
+
+// Ordered 判断是否设置了排序列或键集分页.
+func (whr *Options) Ordered() bool {
+	return len(whr.Orders) > 0 || whr.Keyset != nil
+}
+
+// K 设置键集分页参数并返回自身.
+func (whr *Options) K(keyset Keyset) *Options {
+	whr.Keyset = &keyset
+	return whr
+}
+
 // T 根据全局注册的 Tenant 信息，向 Filters 中添加 Tenant 键值对.
 func (whr *Options) T(ctx context.Context) *Options {
 	if registeredTenant.Key != "" && registeredTenant.ValueFunc != nil {
@@ -194,11 +327,37 @@ func (whr *Options) Where(db *gorm.DB) *gorm.DB {
 		whr.Clauses = append(whr.Clauses, conds...)
 	}
 	// 按顺序应用 Filters、Clauses、Offset、Limit.
-	return db.
+	db = db.
 		Where(whr.Filters).
 		Clauses(whr.Clauses...).
 		Offset(whr.Offset).
 		Limit(whr.Limit)
+	if whr.Keyset != nil {
+		if whr.Keyset.Column != "" {
+			if err := whr.checkOrder(whr.Keyset.Column); err != nil {
+				_ = db.AddError(err)
+				return db
+			}
+		}
+		return whr.Keyset.Where(db.Offset(-1))
+	}
+	for _, order := range whr.Orders {
+		if err := whr.checkOrder(order.Column); err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: order.Column}, Desc: order.Desc})
+	}
+	return db
+}
+
+// checkOrder 检查是否允许按给定的列排序，避免用户输入的排序列导致 SQL 注入.
+func (whr *Options) checkOrder(column string) error {
+	if !columnPattern.MatchString(column) ||
+		(len(whr.OrderAllowlist) > 0 && !slices.Contains(whr.OrderAllowlist, column)) {
+		return errorsx.New(errorsx.ErrInvalidArgument.Code, errorsx.ErrInvalidArgument.Reason, "Unsupported sort field %q", column)
+	}
+	return nil
 }
 
 // 下面是一组便捷函数，直接返回应用了对应参数的 Options.
@@ -223,6 +382,16 @@ func C(conds ...clause.Expression) *Options {
 	return NewWhere().C(conds...)
 }
 
+// S 是创建带排序列的 Options 的简写.
+func S(column string, desc bool) *Options {
+	return NewWhere().S(column, desc)
+}
+
+// K 是创建带键集分页参数的 Options 的简写.
+func K(keyset Keyset) *Options {
+	return NewWhere().K(keyset)
+}
+
 // T 是创建带租户过滤的 Options 的简写.
 func T(ctx context.Context) *Options {
 	return NewWhere().F(registeredTenant.Key, registeredTenant.ValueFunc(ctx))
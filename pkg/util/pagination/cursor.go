@@ -0,0 +1,139 @@
+package pagination
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+)
+
+// cursorValue 是游标中单个值的编码形式，Type 记录值的类型，以便解码时还原.
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+// 游标中支持的值类型.
+const (
+	cursorInt    = "i"
+	cursorUint   = "u"
+	cursorFloat  = "f"
+	cursorString = "s"
+	cursorBool   = "b"
+	cursorTime   = "t"
+)
+
+// EncodeCursor 将键集分页的位置（通常是上一页最后一条记录的排序列和唯一列的值）编码为不透明的游标字符串.
+// 支持整数、浮点数、字符串、布尔值、time.Time 以及它们的指针和实现了 driver.Valuer 的类型.
+// 游标使用 URL 安全的 Base64 编码，可以直接放在 API 响应和查询参数中.
+func EncodeCursor(values ...any) (string, error) {
+	encoded := make([]cursorValue, 0, len(values))
+	for _, value := range values {
+		v, err := encodeCursorValue(value)
+		if err != nil {
+			return "", err
+		}
+		encoded = append(encoded, v)
+	}
+
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor 解码由 EncodeCursor 生成的游标，返回编码时的值.
+// 整数解码为 int64，无符号整数解码为 uint64，浮点数解码为 float64.
+// 游标无效时返回 errorsx.ErrInvalidArgument.
+func DecodeCursor(cursor string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidCursor(err)
+	}
+
+	var encoded []cursorValue
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, invalidCursor(err)
+	}
+
+	values := make([]any, 0, len(encoded))
+	for _, v := range encoded {
+		value, err := decodeCursorValue(v)
+		if err != nil {
+			return nil, invalidCursor(err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// encodeCursorValue 编码游标中的单个值.
+func encodeCursorValue(value any) (cursorValue, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return cursorValue{}, err
+		}
+		value = v
+	}
+	if t, ok := value.(time.Time); ok {
+		return cursorValue{Type: cursorTime, Value: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return cursorValue{}, fmt.Errorf("cursor value cannot be nil")
+		}
+		rv = rv.Elem()
+		if t, ok := rv.Interface().(time.Time); ok {
+			return cursorValue{Type: cursorTime, Value: t.Format(time.RFC3339Nano)}, nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{Type: cursorInt, Value: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{Type: cursorUint, Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{Type: cursorFloat, Value: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	case reflect.String:
+		return cursorValue{Type: cursorString, Value: rv.String()}, nil
+	case reflect.Bool:
+		return cursorValue{Type: cursorBool, Value: strconv.FormatBool(rv.Bool())}, nil
+	default:
+		return cursorValue{}, fmt.Errorf("unsupported cursor value type %T", value)
+	}
+}
+
+// decodeCursorValue 解码游标中的单个值.
+func decodeCursorValue(v cursorValue) (any, error) {
+	switch v.Type {
+	case cursorInt:
+		return strconv.ParseInt(v.Value, 10, 64)
+	case cursorUint:
+		return strconv.ParseUint(v.Value, 10, 64)
+	case cursorFloat:
+		return strconv.ParseFloat(v.Value, 64)
+	case cursorString:
+		return v.Value, nil
+	case cursorBool:
+		return strconv.ParseBool(v.Value)
+	case cursorTime:
+		return time.Parse(time.RFC3339Nano, v.Value)
+	default:
+		return nil, fmt.Errorf("unknown cursor value type %q", v.Type)
+	}
+}
+
+// invalidCursor 返回表示游标无效的错误.
+func invalidCursor(err error) error {
+	return errorsx.New(errorsx.ErrInvalidArgument.Code, errorsx.ErrInvalidArgument.Reason, "Invalid cursor: %v", err)
+}
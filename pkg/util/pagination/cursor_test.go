@@ -0,0 +1,35 @@
+package pagination_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiangNing7/goutils/pkg/errorsx"
+	"github.com/LiangNing7/goutils/pkg/util/pagination"
+)
+
+func TestCursor(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	name := "alice"
+
+	cursor, err := pagination.EncodeCursor(int32(7), uint64(1<<63), 1.5, &name, true, now, int64(1<<62+1))
+	require.NoError(t, err)
+	assert.NotContains(t, cursor, "=")
+
+	values, err := pagination.DecodeCursor(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(7), uint64(1 << 63), 1.5, "alice", true, now, int64(1<<62 + 1)}, values)
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	_, err := pagination.EncodeCursor(struct{}{})
+	assert.Error(t, err)
+
+	for _, cursor := range []string{"%%%", "bm90IGpzb24", "W3sidCI6IngiLCJ2IjoiMSJ9XQ"} {
+		_, err := pagination.DecodeCursor(cursor)
+		assert.ErrorIs(t, err, errorsx.ErrInvalidArgument, cursor)
+	}
+}
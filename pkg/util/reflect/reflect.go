@@ -9,30 +9,94 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// ToGormDBMap 返回对象中指定字段的值，键为 gorm 标签中 column 指定的列名，字段没有指定列名时返回错误.
 func ToGormDBMap(obj any, fields []string) (map[string]any, error) {
-	reflectType := reflect.ValueOf(obj).Type()
+	return ToGormDBMapWithNamer(obj, fields, nil)
+}
+
+// ToGormDBMapWithNamer 返回对象中指定字段的值，键为字段对应的列名.
+// 字段路径可以使用字段名、json 标签名或蛇形命名（如 protobuf FieldMask 中的路径），
+// 嵌套的结构体字段使用 "." 分隔，例如 "Profile.Nickname"，会带上 gorm 标签 embeddedPrefix 指定的前缀.
+// 列名优先使用 gorm 标签中的 column，否则使用 namer 根据字段名生成；namer 为 nil 时字段必须指定列名.
+func ToGormDBMapWithNamer(obj any, fields []string, namer func(name string) string) (map[string]any, error) {
 	reflectValue := reflect.ValueOf(obj)
-	for reflectType.Kind() == reflect.Slice || reflectType.Kind() == reflect.Ptr {
-		reflectType = reflectType.Elem()
-		reflectValue = reflect.ValueOf(obj).Elem()
+	for reflectValue.Kind() == reflect.Ptr {
+		reflectValue = reflectValue.Elem()
+	}
+	if reflectValue.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported type %s", reflectValue.Type())
 	}
 
-	ret := make(map[string]any, 0)
+	ret := make(map[string]any, len(fields))
 	for _, f := range fields {
-		fs, exist := reflectType.FieldByName(f)
-		if !exist {
-			return nil, fmt.Errorf("unknow field %s", f)
+		column, value, err := gormColumn(reflectValue, f, namer)
+		if err != nil {
+			return nil, err
 		}
+		ret[column] = value
+	}
+	return ret, nil
+}
 
+// gormColumn 返回字段路径对应的列名和值.
+func gormColumn(value reflect.Value, path string, namer func(name string) string) (string, any, error) {
+	var prefix string
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		fs, ok := lookupField(value.Type(), segment)
+		if !ok {
+			return "", nil, fmt.Errorf("unknow field %s", path)
+		}
+		var err error
+		if value, err = value.FieldByIndexErr(fs.Index); err != nil {
+			return "", nil, fmt.Errorf("field %s: %w", path, err)
+		}
 		tagMap := parseTagSetting(fs.Tag)
-		gormfiled, exist := tagMap["COLUMN"]
-		if !exist {
-			return nil, fmt.Errorf("undef gorm field %s", f)
+
+		if i == len(segments)-1 {
+			column, ok := tagMap["COLUMN"]
+			if !ok {
+				if namer == nil {
+					return "", nil, fmt.Errorf("undef gorm field %s", path)
+				}
+				column = namer(fs.Name)
+			}
+			return prefix + column, value.Interface(), nil
 		}
 
-		ret[gormfiled] = reflectValue.FieldByName(f)
+		// 只有嵌入的结构体字段可以继续向下查找
+		if value.Kind() != reflect.Struct {
+			return "", nil, fmt.Errorf("field %s is not an embedded struct", strings.Join(segments[:i+1], "."))
+		}
+		if _, embedded := tagMap["EMBEDDED"]; !embedded && !fs.Anonymous {
+			return "", nil, fmt.Errorf("field %s is not an embedded struct", strings.Join(segments[:i+1], "."))
+		}
+		prefix += tagMap["EMBEDDEDPREFIX"]
 	}
-	return ret, nil
+	return "", nil, fmt.Errorf("unknow field %s", path)
+}
+
+// lookupField 根据字段名、json 标签名或蛇形命名查找导出的字段.
+func lookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if fs, ok := t.FieldByName(name); ok && fs.IsExported() {
+		return fs, true
+	}
+
+	normalized := strings.ReplaceAll(strings.ToLower(name), "_", "")
+	fs, ok := t.FieldByNameFunc(func(fieldName string) bool {
+		return strings.ToLower(fieldName) == normalized
+	})
+	if ok && fs.IsExported() {
+		return fs, true
+	}
+
+	for i := range t.NumField() {
+		fs := t.Field(i)
+		if jsonName, _, _ := strings.Cut(fs.Tag.Get("json"), ","); fs.IsExported() && jsonName == name {
+			return fs, true
+		}
+	}
+	return reflect.StructField{}, false
 }
 
 func parseTagSetting(tags reflect.StructTag) map[string]string {
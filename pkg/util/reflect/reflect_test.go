@@ -81,3 +81,57 @@ func TestCopyObj(t *testing.T) {
 		t.Fatalf("expect not changed")
 	}
 }
+
+func TestToGormDBMapWithNamer(t *testing.T) {
+	type Profile struct {
+		Nickname string
+		Age      int `gorm:"column:user_age"`
+	}
+	type Base struct {
+		ID int64
+	}
+	type User struct {
+		Base
+		DisplayName string  `json:"displayName"`
+		Email       string  `gorm:"column:mail"`
+		Profile     Profile `gorm:"embedded;embeddedPrefix:profile_"`
+		Other       Profile
+	}
+
+	user := &User{
+		Base:        Base{ID: 1},
+		DisplayName: "Alice",
+		Email:       "alice@example.com",
+		Profile:     Profile{Nickname: "al", Age: 18},
+	}
+	namer := func(name string) string { return "col_" + name }
+
+	m, err := ToGormDBMapWithNamer(user, []string{"ID", "display_name", "displayName", "Email", "profile.nickname", "Profile.Age"}, namer)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !reflect.DeepEqual(m, map[string]any{
+		"col_ID":               int64(1),
+		"col_DisplayName":      "Alice",
+		"mail":                 "alice@example.com",
+		"profile_col_Nickname": "al",
+		"profile_user_age":     18,
+	}) {
+		t.Fatalf("not equal: %v", m)
+	}
+
+	for _, field := range []string{"Unknown", "Other.Nickname", "Email.Foo", "Profile.Unknown"} {
+		if _, err := ToGormDBMapWithNamer(user, []string{field}, namer); err == nil {
+			t.Fatalf("expect error for field %s", field)
+		}
+	}
+
+	// 没有 namer 时字段必须指定列名
+	if _, err := ToGormDBMap(user, []string{"DisplayName"}); err == nil {
+		t.Fatalf("expect error")
+	}
+	m, err = ToGormDBMap(user, []string{"Email"})
+	if err != nil || !reflect.DeepEqual(m, map[string]any{"mail": "alice@example.com"}) {
+		t.Fatalf("unexpected result %v, %v", m, err)
+	}
+}
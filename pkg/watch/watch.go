@@ -1,6 +1,7 @@
 package watch
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/LiangNing7/goutils/pkg/distlock"
+	"github.com/LiangNing7/goutils/pkg/leaderelection"
 	stringsutil "github.com/LiangNing7/goutils/pkg/util/strings"
 	"github.com/LiangNing7/goutils/pkg/watch/initializer"
 	"github.com/LiangNing7/goutils/pkg/watch/logger/empty"
@@ -41,8 +43,14 @@ type Watch struct {
 	logger Logger
 	// Distributed lock name to be used across instances.
 	lockName string
-	// Distributed lock instance.
+	// Distributed lock used for leader election, a GORMLocker by default.
 	locker distlock.Locker
+	// Leader elector, only the leader runs the jobs.
+	elector *leaderelection.LeaderElector
+	// Cancels the campaign started by Start.
+	cancel context.CancelFunc
+	// Closed when the campaign started by Start has returned.
+	done chan struct{}
 	// healthzPort is the port number for the health check endpoint.
 	healthzPort int
 	// List of watcher names that should be disabled.
@@ -68,6 +76,15 @@ func WithLogger(logger Logger) Option {
 	}
 }
 
+// WithLocker returns an Option function that sets the distributed lock used to
+// elect the instance running the jobs, e.g. a distlock.MemoryLocker in tests.
+// By default a distlock.GORMLocker on the database of the Watch is used.
+func WithLocker(locker distlock.Locker) Option {
+	return func(w *Watch) {
+		w.locker = locker
+	}
+}
+
 // NewWatch creates a new Watch monitoring system with the provided options.
 func NewWatch(opts *Options, db *gorm.DB, withOptions ...Option) (*Watch, error) {
 	logger := empty.NewLogger()
@@ -131,52 +148,87 @@ func (w *Watch) addWatchers() error {
 	return nil
 }
 
-// Start attempts to acquire a distributed lock and starts the Cron job scheduler.
-// It retries acquiring the lock until successful.
+// Start starts campaigning for the leadership of the instances sharing the
+// same lock name, and returns at once. The Cron job scheduler runs only while
+// this instance is the leader. Campaigning goes on until stopCh is closed.
 func (w *Watch) Start(stopCh <-chan struct{}) {
 	if w.healthzPort != 0 {
 		go w.serveHealthz()
 	}
 
-	opts := []distlock.Option{
-		distlock.WithLockTimeout(defaultExpiration),
-		distlock.WithLockName(w.lockName),
-	}
-	w.locker, _ = distlock.NewGORMLocker(w.db, opts...)
-	ticker := time.NewTicker(defaultExpiration + (5 * time.Second))
-	ctx := wait.ContextForChannel(stopCh)
-	var err error
-	for {
-		// Obtain a lock for our given mutex. After this is successful, no one else
-		// can obtain the same lock (the same mutex name) until we unlock it.
-		if err := w.locker.Lock(ctx); err == nil {
-			w.logger.Debug("Successfully acquired lock", "lockName", w.lockName)
-			break
+	if w.locker == nil {
+		opts := []distlock.Option{
+			distlock.WithLockTimeout(defaultExpiration),
+			distlock.WithLockName(w.lockName),
 		}
-
-		w.logger.Debug("Failed to acquire lock.", "lockName", w.lockName, "err", err)
-		<-ticker.C
+		w.locker, _ = distlock.NewGORMLocker(w.db, opts...)
 	}
+	w.elector = leaderelection.NewLeaderElector(w.locker, leaderelection.LeaderCallbacks{
+		OnStartedLeading: w.lead,
+		OnStoppedLeading: func() {
+			w.logger.Info("Stopped leading, all jobs stopped", "lockName", w.lockName)
+		},
+		OnNewLeader: func(identity string) {
+			w.logger.Info("New leader elected", "lockName", w.lockName, "identity", identity)
+		},
+	}, leaderelection.WithRetryPeriod(defaultExpiration+(5*time.Second)))
+
+	ctx, cancel := context.WithCancel(wait.ContextForChannel(stopCh))
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		w.elector.Run(ctx)
+	}()
 
+	w.logger.Info("Successfully started watch server")
+}
+
+// lead runs the jobs while this instance is the leader, that is until ctx is
+// cancelled, and waits for the running jobs to complete.
+func (w *Watch) lead(ctx context.Context) {
+	w.logger.Debug("Successfully acquired lock", "lockName", w.lockName)
 	w.jm.Start()
 
-	w.logger.Info("Successfully started watch server")
+	<-ctx.Done()
+	w.stopJobs()
 }
 
-// Stop blocks until all jobs are completed and releases the distributed lock.
+// Stop stops campaigning, blocks until all jobs are completed and gives up
+// the leadership.
 func (w *Watch) Stop() {
+	if w.cancel != nil {
+		// Run resigns once the jobs are stopped, and campaigns no more
+		w.cancel()
+		<-w.done
+	}
+	if w.elector != nil {
+		if err := w.elector.Resign(context.Background()); err != nil {
+			w.logger.Debug("Failed to release lock", "err", err)
+		}
+	}
+
+	w.logger.Info("Successfully stopped watch server")
+}
+
+// Leader returns the identity of the instance currently running the jobs.
+func (w *Watch) Leader(ctx context.Context) (string, error) {
+	if w.elector == nil {
+		return "", errors.New("watch server has not been started")
+	}
+
+	leader, err := w.elector.Leader(ctx)
+	return leader.Identity, err
+}
+
+// stopJobs stops the job scheduler and waits for the running jobs to complete.
+func (w *Watch) stopJobs() {
 	ctx := w.jm.Stop()
 	select {
 	case <-ctx.Done():
 	case <-time.After(jobStopTimeout):
 		w.logger.Error(errors.New("context was not done immediately"), "timeout", jobStopTimeout.String())
 	}
-
-	if err := w.locker.Unlock(ctx); err != nil {
-		w.logger.Debug("Failed to release lock", "err", err)
-	}
-
-	w.logger.Info("Successfully stopped watch server")
 }
 
 // serveHealthz starts the health check server for the Watch instance.